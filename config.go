@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/xa1st/b2upload/internal/b2"
+	"github.com/xa1st/b2upload/internal/config"
+	"github.com/xa1st/b2upload/internal/util"
+	"golang.org/x/term"
+)
+
+// configCmd 管理配置文件
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "管理配置文件",
+}
+
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "显示正在使用的配置文件及查找路径",
+	Long: `path 显示本次运行加载的配置文件。未使用 --config 指定时，按以下顺序查找 b2upload.toml (或 .yaml、.yml、.json)，使用第一个找到的文件：
+$XDG_CONFIG_HOME/b2upload、用户配置目录、~/.config/b2upload、当前工作目录、可执行文件所在目录、/etc/b2upload。`,
+	Args: cobra.NoArgs,
+	Run:  runConfigPath,
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "交互式创建配置文件",
+	Long: `init 依次询问 B2 Key ID、Application Key、Bucket 以及标签的用户名和 URL，
+通过 B2 授权验证密钥后写入配置文件 (仅当前用户可读写)。
+默认写入 用户配置目录/b2upload/b2upload.toml，可使用 --config 指定其他路径。`,
+	Args: cobra.NoArgs,
+	Run:  runConfigInit,
+}
+
+var configAddTagCmd = &cobra.Command{
+	Use:   "add-tag [标签名]",
+	Short: "交互式向配置文件添加标签",
+	Long:  `add-tag 询问标签的用户名、URL 以及是否使用其他 B2 账户，验证后追加到正在使用的 TOML 配置文件中。`,
+	Args:  cobra.RangeArgs(0, 1),
+	Run:   runConfigAddTag,
+}
+
+var configInitForce bool // 覆盖已存在的配置文件
+
+func init() {
+	configInitCmd.Flags().BoolVar(&configInitForce, "force", false, "配置文件已存在时覆盖")
+	configCmd.AddCommand(configPathCmd, configInitCmd, configAddTagCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// runConfigPath 输出正在使用的配置文件，标准输出只有路径，便于脚本使用
+func runConfigPath(cmd *cobra.Command, args []string) {
+	if configErr != nil {
+		fmt.Fprintln(os.Stderr, configErr.Error())
+		os.Exit(1)
+	}
+	used := viper.ConfigFileUsed()
+	if used != "" {
+		fmt.Println(used)
+		fmt.Fprintf(os.Stderr, "本地数据目录 (上传历史、续传记录): %s\n", appDir())
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, "未找到配置文件，已查找以下目录：")
+	for _, dir := range configSearchPaths() {
+		fmt.Fprintf(os.Stderr, "  %s\n", dir)
+	}
+	os.Exit(1)
+}
+
+// tagNamePattern 是标签名允许的字符，标签名会作为命令行参数和环境变量的一部分
+var tagNamePattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// conflictingCommand 返回与标签名同名的子命令 (包括别名和 cobra 自动添加的 help、completion)，没有冲突时返回空字符串。
+// 第一个参数与子命令同名时会执行子命令，因此这样的标签无法用于 b2upload <标签名> <文件> 上传
+func conflictingCommand(name string) string {
+	reserved := []string{"help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd}
+	for _, cmd := range rootCmd.Commands() {
+		reserved = append(reserved, cmd.Name())
+		reserved = append(reserved, cmd.Aliases...)
+	}
+	for _, cmdName := range reserved {
+		if strings.EqualFold(name, cmdName) {
+			return cmdName
+		}
+	}
+	return ""
+}
+
+// tagConflictError 返回标签名与子命令冲突的错误
+func tagConflictError(name, cmdName string) error {
+	return fmt.Errorf("错误: 标签名 [%s] 与子命令 %s 同名，b2upload %s ... 会执行子命令而不是上传，请在配置文件中重命名该标签", name, cmdName, name)
+}
+
+// prompter 在终端中逐行读取用户输入
+type prompter struct {
+	in *bufio.Reader
+}
+
+func newPrompter() *prompter {
+	return &prompter{in: bufio.NewReader(os.Stdin)}
+}
+
+// ask 显示提示并读取一行输入，输入为空时返回 def；输入已结束时退出
+func (p *prompter) ask(label, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", label, def)
+	} else {
+		fmt.Printf("%s: ", label)
+	}
+	line, err := p.in.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Println()
+		if err == io.EOF {
+			fmt.Fprintln(os.Stderr, "已取消。")
+		} else {
+			fmt.Fprintf(os.Stderr, "错误: 读取输入失败: %v\n", err)
+		}
+		os.Exit(1)
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def
+	}
+	return line
+}
+
+// askRequired 重复询问，直到输入不为空
+func (p *prompter) askRequired(label, def string) string {
+	for {
+		if value := p.ask(label, def); value != "" {
+			return value
+		}
+		fmt.Println("该项不能为空。")
+	}
+}
+
+// askSecret 重复询问密钥直到输入不为空。标准输入为终端时不回显输入内容，否则按行读取
+func (p *prompter) askSecret(label string) string {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return p.askRequired(label, "")
+	}
+	for {
+		fmt.Printf("%s (输入内容不会显示): ", label)
+		secret, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 读取输入失败: %v\n", err)
+			os.Exit(1)
+		}
+		if value := strings.TrimSpace(string(secret)); value != "" {
+			return value
+		}
+		fmt.Println("该项不能为空。")
+	}
+}
+
+// askYes 询问是否继续，输入 y 或 yes 时返回 true
+func (p *prompter) askYes(label string) bool {
+	answer := strings.ToLower(p.ask(label+" [y/N]", ""))
+	return answer == "y" || answer == "yes"
+}
+
+// askTagName 询问标签名并检查格式 (viper 的配置项不区分大小写，统一使用小写)
+func (p *prompter) askTagName(def string) string {
+	for {
+		name := strings.ToLower(p.askRequired("标签名", def))
+		if !tagNamePattern.MatchString(name) {
+			fmt.Println("标签名只能包含字母、数字、- 和 _。")
+			continue
+		}
+		if cmdName := conflictingCommand(name); cmdName != "" {
+			fmt.Printf("标签名不能与子命令 %s 同名。\n", cmdName)
+			continue
+		}
+		return name
+	}
+}
+
+// askCredentials 询问 B2 密钥和 Bucket，并通过 B2 授权验证，验证失败时可以重新输入
+func (p *prompter) askCredentials(apiURL string) (token, bucket string, auth *b2.AuthResponse) {
+	for {
+		keyID := p.askRequired("B2 Key ID", "")
+		key := p.askSecret("B2 Application Key")
+		bucket = p.askRequired("Bucket 名称", "")
+		token = keyID + ":" + key
+
+		var err error
+		if auth, err = verifyCredentials(token, bucket, apiURL); err == nil {
+			fmt.Println("B2 授权验证成功。")
+			return token, bucket, auth
+		}
+		fmt.Fprintf(os.Stderr, "验证失败: %v\n", err)
+		if !p.askYes("是否重新输入？") {
+			os.Exit(1)
+		}
+	}
+}
+
+// askTag 询问标签的用户名和 URL，URL 默认为 B2 官方下载地址下该用户的目录
+func (p *prompter) askTag(name, bucket string, auth *b2.AuthResponse) string {
+	user := p.askRequired("用户名 (文件保存的目录)", name)
+	defaultURL := fmt.Sprintf("%s/file/%s/%s", auth.DownloadURL, bucket, user)
+	url := strings.TrimSuffix(p.askRequired("公开访问 URL (自定义域名应指向该 Bucket 的 "+user+"/ 目录)", defaultURL), "/")
+	return fmt.Sprintf("\n[tags.%s]\nusername = %s\nurl = %s\n", name, tomlQuote(user), tomlQuote(url))
+}
+
+// verifyCredentials 使用 b2_authorize_account 验证密钥，并检查密钥是否能访问指定的 Bucket
+func verifyCredentials(token, bucket, apiURL string) (*b2.AuthResponse, error) {
+	cfg := &config.Config{
+		Tag:            "config",
+		Token:          token,
+		Bucket:         bucket,
+		MaxRetries:     1,
+		RetryBaseDelay: config.DefaultRetryBaseDelay,
+		RetryMaxDelay:  config.DefaultRetryMaxDelay,
+	}
+	if err := cfg.SetAPIURL(apiURL); err != nil {
+		return nil, err
+	}
+	uploader := b2.NewUploader(cfg)
+	if err := uploader.AuthorizeAccount(); err != nil {
+		return nil, err
+	}
+	auth := uploader.Auth
+	if allowed := allowedBucketNames(auth); len(allowed) > 0 && !slices.Contains(allowed, bucket) {
+		return nil, fmt.Errorf("该密钥只能访问 Bucket %s，而不是 %s", strings.Join(allowed, "、"), bucket)
+	}
+	return auth, nil
+}
+
+// allowedBucketNames 返回密钥限定的 Bucket 名称，为空表示可以访问所有 Bucket
+func allowedBucketNames(auth *b2.AuthResponse) []string {
+	var names []string
+	for _, bucket := range auth.Permissions().Buckets {
+		names = append(names, bucket.Name)
+	}
+	return names
+}
+
+// tomlQuote 将字符串转换为 TOML 基本字符串
+func tomlQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, "\\u%04X", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// defaultConfigPath 返回 config init 默认写入的路径：用户配置目录/b2upload/b2upload.toml
+func defaultConfigPath() string {
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "b2upload", "b2upload.toml")
+	}
+	return filepath.Join(appDir(), "b2upload.toml")
+}
+
+// runConfigInit 交互式创建配置文件
+func runConfigInit(cmd *cobra.Command, args []string) {
+	path := configFile
+	if path == "" {
+		path = defaultConfigPath()
+	}
+	if _, err := os.Stat(path); err == nil && !configInitForce {
+		fmt.Fprintf(os.Stderr, "错误: 配置文件 %s 已存在，使用 --force 覆盖，或使用 b2upload config add-tag 添加标签\n", path)
+		os.Exit(1)
+	}
+
+	p := newPrompter()
+	fmt.Println("在 Backblaze 控制台的 Application Keys 页面创建密钥 (建议只允许访问一个 Bucket)。")
+	token, bucket, auth := p.askCredentials(viper.GetString("api_url"))
+
+	var b strings.Builder
+	b.WriteString("# b2upload 配置文件，由 b2upload config init 生成\n\n")
+	b.WriteString("# B2 Key ID 和 Application Key，用冒号分隔\n")
+	fmt.Fprintf(&b, "token = %s\n", tomlQuote(token))
+	b.WriteString("# 目标 Bucket\n")
+	fmt.Fprintf(&b, "bucket = %s\n", tomlQuote(bucket))
+
+	var tags []string
+	for {
+		def := ""
+		if len(tags) == 0 {
+			def = "custom"
+		}
+		fmt.Println()
+		name := p.askTagName(def)
+		if slices.Contains(tags, name) {
+			fmt.Printf("标签 %s 已添加。\n", name)
+			continue
+		}
+		b.WriteString(p.askTag(name, bucket, auth))
+		tags = append(tags, name)
+		if !p.askYes("继续添加标签？") {
+			break
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 无法创建配置目录: %v\n", err)
+		os.Exit(1)
+	}
+	// 配置文件包含密钥，WriteFileAtomic 创建的文件仅当前用户可读写
+	if err := util.WriteFileAtomic(path, []byte(b.String())); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 写入配置文件失败: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\n已写入配置文件 %s\n现在可以使用 b2upload %s <文件> 上传文件。\n", path, tags[0])
+}
+
+// runConfigAddTag 交互式向正在使用的配置文件追加标签
+func runConfigAddTag(cmd *cobra.Command, args []string) {
+	path := viper.ConfigFileUsed()
+	if configErr != nil {
+		fmt.Fprintln(os.Stderr, configErr.Error())
+		os.Exit(1)
+	}
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "错误: 未找到配置文件，请先运行 b2upload config init")
+		os.Exit(1)
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext != ".toml" {
+		fmt.Fprintf(os.Stderr, "错误: add-tag 只支持 TOML 配置文件，请手动编辑 %s\n", path)
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 读取配置文件失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	p := newPrompter()
+	var name string
+	if len(args) == 1 {
+		name = strings.ToLower(args[0])
+		if !tagNamePattern.MatchString(name) {
+			fmt.Fprintln(os.Stderr, "错误: 标签名只能包含字母、数字、- 和 _")
+			os.Exit(1)
+		}
+		if cmdName := conflictingCommand(name); cmdName != "" {
+			fmt.Fprintf(os.Stderr, "错误: 标签名不能与子命令 %s 同名\n", cmdName)
+			os.Exit(1)
+		}
+	} else {
+		name = p.askTagName("")
+	}
+	if viper.IsSet("tags." + name) {
+		fmt.Fprintf(os.Stderr, "错误: 标签 [%s] 已存在于 %s\n", name, path)
+		os.Exit(1)
+	}
+
+	// 默认使用配置根部的密钥，也可以为该标签单独设置另一个 B2 账户
+	var section strings.Builder
+	token, bucket := rootToken(), viper.GetString("bucket")
+	apiURL := viper.GetString("api_url")
+	var auth *b2.AuthResponse
+	if token == "" || bucket == "" || p.askYes("该标签是否使用其他 B2 账户或 Bucket？") {
+		token, bucket, auth = p.askCredentials(apiURL)
+		fmt.Fprintf(&section, "token = %s\nbucket = %s\n", tomlQuote(token), tomlQuote(bucket))
+	} else if auth, err = verifyCredentials(token, bucket, apiURL); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 配置中的密钥验证失败: %v\n", err)
+		os.Exit(1)
+	}
+	tag := p.askTag(name, bucket, auth) + section.String()
+
+	content := strings.TrimRight(string(data), "\n") + "\n" + tag
+	if err := util.WriteFileAtomic(path, []byte(content)); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 写入配置文件失败: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("已将标签 [%s] 添加到 %s\n", name, path)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xa1st/b2upload/internal/b2"
+)
+
+// deleteCmd 删除已上传到 B2 的文件
+var deleteCmd = &cobra.Command{
+	Use:   "delete <标签名> <URL或远程路径>...",
+	Short: "删除已上传的文件",
+	Long: `delete 删除已上传到 B2 的文件。参数可以是上传后得到的公开 URL，也可以是 B2 中的文件名 (远程路径)。
+默认只删除最新的版本，如果存在旧版本，旧版本会重新变为可见；使用 --all-versions 删除该文件的所有版本。
+删除前会列出将要删除的文件版本并要求确认，使用 --yes 跳过确认。`,
+	Args: cobra.MinimumNArgs(2),
+	Run:  runDelete,
+}
+
+var (
+	deleteAllVersions bool // 删除文件的所有版本
+	deleteYes         bool // 跳过确认
+)
+
+func init() {
+	deleteCmd.Flags().BoolVar(&deleteAllVersions, "all-versions", false, "删除文件的所有版本 (默认只删除最新版本)")
+	deleteCmd.Flags().BoolVarP(&deleteYes, "yes", "y", false, "不询问，直接删除")
+	rootCmd.AddCommand(deleteCmd)
+}
+
+// deleteTarget 是一个待删除的文件版本
+type deleteTarget struct {
+	arg     string // 命令行参数 (URL 或远程路径)
+	version b2.UploadFileResponse
+}
+
+// runDelete 查找所有参数对应的文件版本，确认后逐个删除
+func runDelete(cmd *cobra.Command, args []string) {
+	tagName := args[0]
+	uploader, err := authorizedUploader(tagName, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	// 1. 将 URL 还原为文件名并查找文件版本
+	var targets []deleteTarget
+	failed := 0
+	for _, arg := range args[1:] {
+		versions, err := findVersions(uploader, arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %s: %v\n", arg, err)
+			failed++
+			continue
+		}
+		if !deleteAllVersions && len(versions) > 1 {
+			fmt.Printf("提示: %s 还有 %d 个旧版本，删除最新版本后旧版本会重新可见 (可使用 --all-versions 全部删除)\n", versions[0].FileName, len(versions)-1)
+			versions = versions[:1]
+		}
+		for _, v := range versions {
+			targets = append(targets, deleteTarget{arg: arg, version: v})
+		}
+	}
+	if len(targets) == 0 {
+		fmt.Println("没有需要删除的文件。")
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 2. 列出并确认
+	fmt.Printf("将要删除以下 %d 个文件版本 (标签: %s, Bucket: %s)：\n", len(targets), tagName, uploader.Config.Bucket)
+	for _, t := range targets {
+		uploaded := time.UnixMilli(t.version.UploadTimestamp).Format("2006-01-02 15:04:05")
+		fmt.Printf("  %s  (%s, %d 字节, %s)\n", t.version.FileName, uploaded, t.version.ContentLength, t.version.Action)
+	}
+	if !deleteYes && !confirm("确认删除？此操作无法撤销 [y/N]: ") {
+		fmt.Println("已取消。")
+		return
+	}
+
+	// 3. 删除
+	for _, t := range targets {
+		if err := uploader.DeleteFileVersion(t.version.FileName, t.version.FileID); err != nil {
+			fmt.Printf("删除失败：%s，错误信息：%v\n", t.version.FileName, err)
+			failed++
+			continue
+		}
+		fmt.Printf("已删除：%s (%s)\n", t.version.FileName, t.version.FileID)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// findVersions 查找 URL 或远程路径对应的文件版本 (从新到旧)，多个候选文件名时使用第一个存在的
+func findVersions(uploader *b2.Uploader, arg string) ([]b2.UploadFileResponse, error) {
+	keys, err := uploader.RemoteKeys(arg)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		versions, err := uploader.FileVersions(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) > 0 {
+			return versions, nil
+		}
+	}
+	return nil, fmt.Errorf("B2 中不存在文件 %s", strings.Join(keys, " 或 "))
+}
+
+// confirm 在终端询问用户，输入 y 或 yes 时返回 true
+func confirm(prompt string) bool {
+	fmt.Print(prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Println()
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/xa1st/b2upload/internal/b2"
+	"github.com/xa1st/b2upload/internal/config"
+	"github.com/xa1st/b2upload/internal/server"
+	"github.com/xa1st/b2upload/internal/util"
+)
+
+// doctorCmd 全面检查配置、密钥权限和公开链接
+var doctorCmd = &cobra.Command{
+	Use:   "doctor [标签名]...",
+	Short: "检查配置、密钥权限，并通过测试上传确认公开链接可以访问",
+	Long: `doctor 先执行 config validate 的全部检查，然后对每个标签 (默认为全部标签)：
+进行 B2 授权并报告密钥的权限和 Bucket 限制，检查配置的 Bucket 是否与密钥一致；
+上传一个测试文件，通过生成的公开链接下载并核对内容，最后删除测试文件。`,
+	Run: runDoctor,
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "检查配置文件中的错误 (不连接 B2)",
+	Long:  `validate 检查未知或拼写错误的配置项、缺少 username 的标签、无效的 URL、路径模板和链接模板等，有错误时返回非 0。`,
+	Args:  cobra.NoArgs,
+	Run:   runConfigValidate,
+}
+
+var doctorNoUpload bool // 跳过测试上传
+
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorNoUpload, "no-upload", false, "跳过测试上传和链接检查")
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// rootConfigKeys 是配置文件根部 (包括 [retry]、[serve]、[watch]) 支持的配置项
+var rootConfigKeys = []string{
+	"token", "bucket", "baseurl", "api_url", "path_template", "format", "template",
+	"large_file_threshold", "part_size", "part_concurrency", "history", "history_file", "state_file",
+	"retry.max_retries", "retry.base_delay", "retry.max_delay",
+	"serve.listen", "serve.token", "serve.tag", "serve.max_body_mb",
+	"watch.hook", "watch.state_file",
+}
+
+// tagConfigKeys 是 [tags.XXX] 下支持的配置项
+var tagConfigKeys = []string{
+	"username", "url", "token", "bucket", "baseurl", "api_url", "path_template", "format", "template", "watch_hook",
+}
+
+// requiredCapabilities 是各功能需要的密钥权限，writeFiles 缺失时无法上传
+var requiredCapabilities = []struct {
+	name  string
+	usage string
+}{
+	{"listFiles", "检查远程是否已存在、ls、sync"},
+	{"readFiles", "get 下载以及私有 Bucket 的链接"},
+	{"deleteFiles", "delete、sync --delete 以及删除测试文件"},
+}
+
+// checker 输出检查结果并统计错误和警告
+type checker struct {
+	errors, warnings int
+}
+
+func (c *checker) ok(format string, args ...interface{}) {
+	fmt.Printf("[通过] "+format+"\n", args...)
+}
+
+func (c *checker) warn(format string, args ...interface{}) {
+	c.warnings++
+	fmt.Printf("[警告] "+format+"\n", args...)
+}
+
+func (c *checker) fail(format string, args ...interface{}) {
+	c.errors++
+	fmt.Printf("[错误] "+format+"\n", args...)
+}
+
+// summary 输出统计结果，有错误时以非 0 状态退出
+func (c *checker) summary() {
+	fmt.Printf("\n检查完成：%d 个错误，%d 个警告\n", c.errors, c.warnings)
+	if c.errors > 0 {
+		os.Exit(1)
+	}
+}
+
+// runConfigValidate 只检查配置，不连接 B2
+func runConfigValidate(cmd *cobra.Command, args []string) {
+	c := &checker{}
+	validateConfig(c)
+	c.summary()
+}
+
+// runDoctor 检查配置，然后逐个标签检查授权、权限和公开链接
+func runDoctor(cmd *cobra.Command, args []string) {
+	c := &checker{}
+	configs := validateConfig(c)
+	if len(args) > 0 {
+		selected := make(map[string]*config.Config)
+		for _, name := range args {
+			name = strings.ToLower(name)
+			cfg, ok := configs[name]
+			if !ok {
+				if cfg, ok = tryLoadTag(c, name); !ok {
+					continue
+				}
+			}
+			selected[name] = cfg
+		}
+		configs = selected
+	}
+
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("\n== 标签 [%s] ==\n", name)
+		doctorTag(c, configs[name])
+	}
+	c.summary()
+}
+
+// tryLoadTag 加载配置文件中没有列出的标签 (例如只通过环境变量设置的标签)
+func tryLoadTag(c *checker, name string) (*config.Config, bool) {
+	cfg, err := loadTagConfig(name)
+	if err != nil {
+		c.fail("%s", strings.TrimPrefix(err.Error(), "错误: "))
+		return nil, false
+	}
+	return cfg, true
+}
+
+// validateConfig 检查配置文件和每个标签，返回能够正常加载的标签配置
+func validateConfig(c *checker) map[string]*config.Config {
+	configs := make(map[string]*config.Config)
+	if configErr != nil {
+		c.fail("%s", strings.TrimPrefix(configErr.Error(), "错误: "))
+		return configs
+	}
+
+	// 1. 配置文件中的未知配置项 (只检查文件本身，不包括环境变量和默认值)
+	used := viper.ConfigFileUsed()
+	if used == "" {
+		c.warn("未找到配置文件，只使用环境变量和命令行参数 (运行 b2upload config path 查看查找路径)")
+	} else {
+		c.ok("配置文件: %s", used)
+		fileConfig := viper.New()
+		fileConfig.SetConfigFile(used)
+		if err := fileConfig.ReadInConfig(); err != nil {
+			c.fail("无法解析配置文件: %v", err)
+			return configs
+		}
+		unknown := 0
+		keys := fileConfig.AllKeys()
+		sort.Strings(keys)
+		for _, key := range keys {
+			if knownConfigKey(key) {
+				continue
+			}
+			unknown++
+			if suggestion := suggestConfigKey(key); suggestion != "" {
+				c.fail("未知的配置项 %s，是否应为 %s？", key, suggestion)
+			} else {
+				c.fail("未知的配置项 %s", key)
+			}
+		}
+		if unknown == 0 {
+			c.ok("没有未知的配置项")
+		}
+		if raw := fileConfig.GetString("baseurl"); raw != "" {
+			if err := checkURL(raw); err != nil {
+				c.fail("baseurl %v", err)
+			}
+		}
+	}
+
+	// 2. 逐个加载标签，检查 username、URL、路径模板和链接模板
+	tags := make([]string, 0)
+	for name := range viper.GetStringMap("tags") {
+		tags = append(tags, name)
+	}
+	sort.Strings(tags)
+	if len(tags) == 0 {
+		c.fail("没有配置任何标签，请添加 [tags.标签名] 并设置 username")
+	}
+	for _, name := range tags {
+		if cmdName := conflictingCommand(name); cmdName != "" {
+			c.fail("%s", strings.TrimPrefix(tagConflictError(name, cmdName).Error(), "错误: "))
+			continue
+		}
+		if viper.GetString("tags."+name+".username") == "" {
+			c.fail("标签 [%s] 缺少 username (文件保存的目录)", name)
+			continue
+		}
+		cfg, ok := tryLoadTag(c, name)
+		if !ok {
+			continue
+		}
+		if err := checkURL(cfg.URL); err != nil {
+			c.fail("标签 [%s] 的 URL %v", name, err)
+			continue
+		}
+		if _, err := loadLinkRenderer(name); err != nil {
+			c.fail("%s", strings.TrimPrefix(err.Error(), "错误: "))
+			continue
+		}
+		if viper.GetString("tags."+name+".url") == "" {
+			c.warn("标签 [%s] 未设置 url，将使用 baseurl (%s) 生成链接，请确认该地址指向 Bucket 中的 %s/ 目录", name, cfg.URL, cfg.User)
+		}
+		c.ok("标签 [%s]: 用户 %s，Bucket %s，URL %s", name, cfg.User, cfg.Bucket, cfg.URL)
+		configs[name] = cfg
+	}
+
+	// 3. 本地上传服务
+	if tag := viper.GetString("serve.tag"); tag != "" && !viper.IsSet("tags."+tag+".username") {
+		c.fail("serve.tag 指定的标签 [%s] 不存在", tag)
+	}
+	if listen := viper.GetString("serve.listen"); listen != "" {
+		if _, _, err := net.SplitHostPort(listen); err != nil {
+			c.fail("serve.listen 地址 %q 无效: %v", listen, err)
+		} else if srv := (&server.Server{Listen: listen}); srv.RequiresToken() && viper.GetString("serve.token") == "" {
+			c.fail("serve.listen 地址 %q 不是本机回环地址，必须设置 serve.token", listen)
+		}
+	}
+	return configs
+}
+
+// knownConfigKey 判断配置文件中的配置项是否受支持
+func knownConfigKey(key string) bool {
+	for _, known := range rootConfigKeys {
+		if key == known {
+			return true
+		}
+	}
+	parts := strings.Split(key, ".")
+	if len(parts) == 3 && parts[0] == "tags" {
+		for _, known := range tagConfigKeys {
+			if parts[2] == known {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// suggestConfigKey 为未知的配置项查找最相近的配置项 (例如 base_url -> baseurl、[tag.x] -> [tags.x])，找不到时返回空字符串
+func suggestConfigKey(key string) string {
+	parts := strings.Split(key, ".")
+	candidates := append([]string{}, rootConfigKeys...)
+	if len(parts) == 3 {
+		for _, field := range tagConfigKeys {
+			candidates = append(candidates, "tags."+parts[1]+"."+field)
+		}
+	}
+	best, bestDistance := "", 3
+	for _, candidate := range candidates {
+		if d := editDistance(key, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	if best == "" && len(parts) == 3 && parts[0] == "tags" {
+		// 缩写，例如 user -> username
+		for _, field := range tagConfigKeys {
+			if strings.HasPrefix(field, parts[2]) {
+				return "tags." + parts[1] + "." + field
+			}
+		}
+	}
+	return best
+}
+
+// editDistance 计算两个字符串的编辑距离
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+// checkURL 检查链接地址是否为有效的 http(s) URL
+func checkURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%q 无效: %v", raw, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("%q 无效，应以 http:// 或 https:// 开头并包含域名", raw)
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("%q 不应包含 ? 或 # 部分", raw)
+	}
+	return nil
+}
+
+// doctorTag 检查标签的 B2 授权、密钥权限和 Bucket 限制，并通过测试上传检查公开链接
+func doctorTag(c *checker, cfg *config.Config) {
+	uploader := b2.NewUploader(cfg)
+	uploader.Log = io.Discard
+	if err := uploader.AuthorizeAccount(); err != nil {
+		c.fail("B2 授权失败: %v", err)
+		return
+	}
+	auth := uploader.Auth
+	c.ok("B2 授权成功 (账户 %s，API %s)", auth.AccountID, auth.APIURL)
+
+	// 1. 密钥权限
+	perms := auth.Permissions()
+	if len(perms.Capabilities) == 0 {
+		c.warn("授权响应中没有密钥权限信息")
+	} else {
+		c.ok("密钥权限: %s", strings.Join(perms.Capabilities, ", "))
+		if !slices.Contains(perms.Capabilities, "writeFiles") {
+			c.fail("密钥缺少 writeFiles 权限，无法上传文件")
+		}
+		for _, required := range requiredCapabilities {
+			if !slices.Contains(perms.Capabilities, required.name) {
+				c.warn("密钥缺少 %s 权限，以下功能无法使用：%s", required.name, required.usage)
+			}
+		}
+	}
+
+	// 2. Bucket 和文件名前缀限制
+	if allowed := allowedBucketNames(auth); len(allowed) == 0 {
+		c.ok("密钥可以访问账户下的所有 Bucket")
+	} else if slices.Contains(allowed, cfg.Bucket) {
+		c.ok("密钥限定 Bucket: %s，与配置一致", strings.Join(allowed, "、"))
+	} else {
+		c.fail("密钥只能访问 Bucket %s，但配置的 Bucket 为 %s", strings.Join(allowed, "、"), cfg.Bucket)
+		return
+	}
+	if perms.NamePrefix != "" {
+		if strings.HasPrefix(cfg.User+"/", perms.NamePrefix) {
+			c.ok("密钥限定文件名前缀 %s，与用户名目录 %s/ 一致", perms.NamePrefix, cfg.User)
+		} else {
+			c.fail("密钥只能访问以 %s 开头的文件，而标签的文件保存在 %s/ 下", perms.NamePrefix, cfg.User)
+		}
+	}
+
+	if doctorNoUpload {
+		return
+	}
+	doctorTestUpload(c, uploader)
+}
+
+// doctorTestUpload 上传一个内容唯一的测试文件，通过公开链接下载并核对内容，最后删除测试文件的所有版本
+func doctorTestUpload(c *checker, uploader *b2.Uploader) {
+	dir, err := os.MkdirTemp("", "b2upload-doctor")
+	if err != nil {
+		c.fail("无法创建测试文件: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	localFile := filepath.Join(dir, "b2upload-doctor.txt")
+	content := fmt.Sprintf("b2upload doctor %s\n", time.Now().Format(time.RFC3339Nano))
+	if err := os.WriteFile(localFile, []byte(content), 0o644); err != nil {
+		c.fail("无法创建测试文件: %v", err)
+		return
+	}
+
+	res := uploader.UploadFiles([]util.SourceFile{{Path: localFile, Rel: filepath.Base(localFile)}})[0]
+	if res.Error != nil {
+		c.fail("测试上传失败: %v", res.Error)
+		return
+	}
+	c.ok("测试上传成功: %s", res.RemotePath)
+	defer func() {
+		versions, err := uploader.FileVersions(res.RemotePath)
+		if err == nil {
+			for _, v := range versions {
+				if err = uploader.DeleteFileVersion(v.FileName, v.FileID); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			c.warn("删除测试文件失败，请手动删除 %s: %v", res.RemotePath, err)
+			return
+		}
+		c.ok("已删除测试文件")
+	}()
+
+	// 通过生成的公开链接下载，确认链接确实指向刚上传的文件
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(res.PublicURL)
+	if err != nil {
+		c.fail("无法访问公开链接 %s: %v", res.PublicURL, err)
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	switch {
+	case err != nil:
+		c.fail("读取公开链接 %s 失败: %v", res.PublicURL, err)
+	case resp.StatusCode != http.StatusOK:
+		c.fail("公开链接 %s 返回 %s，请检查 URL 是否指向 Bucket %s 的 %s/ 目录，以及 Bucket 是否公开",
+			res.PublicURL, resp.Status, uploader.Config.Bucket, uploader.Config.User)
+	case string(body) != content:
+		c.fail("公开链接 %s 返回的内容与上传的测试文件不一致，URL 可能指向了其他位置", res.PublicURL)
+	default:
+		c.ok("公开链接可以访问且内容一致: %s", res.PublicURL)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xa1st/b2upload/internal/b2"
+	"github.com/xa1st/b2upload/internal/util"
+)
+
+// getCmd 从 B2 下载已上传的文件
+var getCmd = &cobra.Command{
+	Use:   "get <标签名> <URL或远程路径> [目标]",
+	Short: "下载已上传的文件",
+	Long: `get 下载已上传到 B2 的文件。参数可以是上传后得到的公开 URL，也可以是 B2 中的文件名 (远程路径)。
+目标省略或为已存在的目录时，使用上传时保存的原始文件名 (没有保存时使用远程文件名) 保存到该目录。
+下载中断后再次执行同一命令会从中断处继续，下载完成后会校验 SHA1。`,
+	Args: cobra.RangeArgs(2, 3),
+	Run:  runGet,
+}
+
+var getForce bool // 覆盖已存在的目标文件
+
+func init() {
+	getCmd.Flags().BoolVar(&getForce, "force", false, "目标文件已存在时覆盖")
+	rootCmd.AddCommand(getCmd)
+}
+
+// runGet 查找文件并下载到目标位置
+func runGet(cmd *cobra.Command, args []string) {
+	tagName := args[0]
+	uploader, err := authorizedUploader(tagName, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	file, err := uploader.FindFile(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %s: %v\n", args[1], err)
+		os.Exit(1)
+	}
+
+	dest := "."
+	if len(args) == 3 {
+		dest = args[2]
+	}
+	if info, err := os.Stat(dest); err == nil && info.IsDir() {
+		name := b2.OriginalName(file)
+		if name == "" {
+			name = path.Base(file.FileName)
+		}
+		dest = filepath.Join(dest, name)
+	}
+	if _, err := os.Stat(dest); err == nil && !getForce {
+		fmt.Fprintf(os.Stderr, "错误: 目标文件 %s 已存在，使用 --force 覆盖\n", dest)
+		os.Exit(1)
+	}
+
+	fmt.Printf("正在下载：%s (%s) -> %s\n", file.FileName, util.FormatSize(file.ContentLength), dest)
+	start := time.Now()
+	if err := uploader.Download(file, dest); err != nil {
+		fmt.Fprintf(os.Stderr, "下载失败：%s，错误信息：%v\n", file.FileName, err)
+		os.Exit(1)
+	}
+	fmt.Printf("下载完成：%s，耗时 %.2f 秒\n", dest, time.Since(start).Seconds())
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/xa1st/b2upload/internal/b2"
+	"github.com/xa1st/b2upload/internal/format"
+	"github.com/xa1st/b2upload/internal/history"
+	"github.com/xa1st/b2upload/internal/util"
+)
+
+// historyCmd 查询本地保存的上传历史
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "查询上传历史",
+	Long:  `history 查询本地保存的上传历史 (默认为配置文件同目录下的 b2upload.history.jsonl)，可按标签、时间和文件名过滤，并按任意链接格式或 JSON 重新输出。`,
+}
+
+var historyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "列出最近的上传记录",
+	Args:  cobra.NoArgs,
+	Run:   runHistoryList,
+}
+
+var historySearchCmd = &cobra.Command{
+	Use:   "search <关键字>",
+	Short: "在本地路径、远程路径和 URL 中搜索上传记录",
+	Args:  cobra.ExactArgs(1),
+	Run:   runHistoryList,
+}
+
+var historyShowCmd = &cobra.Command{
+	Use:   "show <编号|URL|远程路径>",
+	Short: "显示一条上传记录的详细信息",
+	Args:  cobra.ExactArgs(1),
+	Run:   runHistoryShow,
+}
+
+var historyExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "导出上传记录 (json、ndjson 或 csv)",
+	Args:  cobra.NoArgs,
+	Run:   runHistoryExport,
+}
+
+var (
+	historyFilterArgs struct {
+		tag, since, until, name string
+	}
+	historyLimit int    // list / search 最多显示的条数
+	exportFile   string // export 的输出文件，默认为标准输出
+	exportFormat string // export 的导出格式，与其他命令共用的 outputFormat 分开
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{historyListCmd, historySearchCmd, historyExportCmd} {
+		cmd.Flags().StringVar(&historyFilterArgs.tag, "tag", "", "只显示该标签的记录")
+		cmd.Flags().StringVar(&historyFilterArgs.since, "since", "", "起始时间，如 2025-11-01、2025-11-01 08:00 或 7d")
+		cmd.Flags().StringVar(&historyFilterArgs.until, "until", "", "结束时间 (只有日期时包含当天)")
+		cmd.Flags().StringVar(&historyFilterArgs.name, "name", "", "本地文件名，支持通配符 (如 *.png)")
+	}
+	for _, cmd := range []*cobra.Command{historyListCmd, historySearchCmd} {
+		cmd.Flags().IntVarP(&historyLimit, "limit", "n", 20, "最多显示最近的多少条记录 (0 表示全部)")
+		cmd.Flags().StringVarP(&linkFormat, "format", "f", "", "按格式输出链接：markdown、html、bbcode、rst、url 或 template")
+		cmd.Flags().StringVar(&linkTemplate, "template", "", "自定义链接模板 (Go text/template)")
+		cmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "输出格式：text、json 或 ndjson")
+	}
+	historyExportCmd.Flags().StringVarP(&exportFormat, "output", "o", outputJSON, "导出格式：json、ndjson 或 csv")
+	historyExportCmd.Flags().StringVar(&exportFile, "file", "", "写入指定文件，默认输出到标准输出")
+
+	historyCmd.AddCommand(historyListCmd, historySearchCmd, historyShowCmd, historyExportCmd)
+	rootCmd.AddCommand(historyCmd)
+}
+
+// historyFilePath 返回上传历史文件路径 (可通过 history_file 配置项指定)
+func historyFilePath() string {
+	if path := viper.GetString("history_file"); path != "" {
+		return path
+	}
+	return filepath.Join(appDir(), "b2upload.history.jsonl")
+}
+
+// openHistory 打开上传历史，history = false 时返回 nil
+func openHistory() *history.Store {
+	if !viper.GetBool("history") {
+		return nil
+	}
+	return history.Open(historyFilePath())
+}
+
+// recordHistory 将成功的上传结果 (包括因已存在而跳过的文件) 写入上传历史，失败时只给出警告
+func recordHistory(tagName string, results []b2.UploadResult) {
+	store := openHistory()
+	if store == nil {
+		return
+	}
+	now := time.Now()
+	var entries []history.Entry
+	for _, res := range results {
+		if res.Error != nil {
+			continue
+		}
+		localFile, err := filepath.Abs(res.LocalFile)
+		if err != nil {
+			localFile = res.LocalFile
+		}
+		entries = append(entries, history.Entry{
+			Time:        now,
+			Tag:         tagName,
+			LocalFile:   localFile,
+			RemotePath:  res.RemotePath,
+			URL:         res.PublicURL,
+			Size:        res.Size,
+			ContentType: res.ContentType,
+			MD5:         res.MD5,
+			SHA1:        res.SHA1,
+			Skipped:     res.Skipped,
+		})
+	}
+	if err := store.Append(entries...); err != nil {
+		fmt.Fprintf(logOut(), "警告: %v\n", err)
+	}
+}
+
+// historyFilter 根据命令行参数构造查询条件
+func historyFilter() (history.Filter, error) {
+	filter := history.Filter{Tag: historyFilterArgs.tag, Name: historyFilterArgs.name}
+	var err error
+	if filter.Since, err = util.ParseTimeArg(historyFilterArgs.since, false); err != nil {
+		return filter, fmt.Errorf("--since: %w", err)
+	}
+	if filter.Until, err = util.ParseTimeArg(historyFilterArgs.until, true); err != nil {
+		return filter, fmt.Errorf("--until: %w", err)
+	}
+	return filter, nil
+}
+
+// loadHistory 读取满足条件的上传记录
+func loadHistory(filter history.Filter) []history.Entry {
+	store := openHistory()
+	if store == nil {
+		fmt.Fprintln(os.Stderr, "错误: 上传历史已关闭 (history = false)")
+		os.Exit(1)
+	}
+	entries, err := store.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+	matched := entries[:0]
+	for _, e := range entries {
+		if filter.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+// historyLink 将上传记录转换为渲染链接所需的信息
+func historyLink(e history.Entry) format.Link {
+	return format.NewLink(e.LocalFile, e.RemotePath, e.URL, e.ContentType, e.Size, e.MD5, e.SHA1, e.Skipped)
+}
+
+// historyRecord 是上传记录的 JSON 输出，包含记录编号和渲染后的链接
+type historyRecord struct {
+	ID   int    `json:"id"`
+	Link string `json:"link,omitempty"`
+	history.Entry
+}
+
+// runHistoryList 列出 (或搜索) 最近的上传记录
+func runHistoryList(cmd *cobra.Command, args []string) {
+	if err := validateOutputFormat(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	filter, err := historyFilter()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+	if len(args) == 1 {
+		filter.Query = args[0]
+	}
+	if linkFormat != "" || linkTemplate != "" {
+		if linkRenderer, err = format.NewRenderer(linkFormat, linkTemplate); err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	entries := loadHistory(filter)
+	if historyLimit > 0 && len(entries) > historyLimit {
+		entries = entries[len(entries)-historyLimit:]
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(logOut(), "没有找到匹配的上传记录。")
+	}
+
+	switch {
+	case outputFormat == outputJSON || outputFormat == outputNDJSON:
+		writeHistoryJSON(os.Stdout, entries, outputFormat == outputJSON)
+	case linkRenderer != nil:
+		for _, e := range entries {
+			text, err := linkRenderer.Render(historyLink(e))
+			if err != nil {
+				text = e.URL
+			}
+			fmt.Println(text)
+		}
+	default:
+		for _, e := range entries {
+			fmt.Printf("#%-5d %s  [%s]  %s  %s\n", e.ID, e.Time.Local().Format("2006-01-02 15:04"), e.Tag, filepath.Base(e.LocalFile), e.URL)
+		}
+	}
+}
+
+// runHistoryShow 显示一条记录的全部字段，参数可以是记录编号、URL 或远程路径
+func runHistoryShow(cmd *cobra.Command, args []string) {
+	entries := loadHistory(history.Filter{})
+	id, idErr := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+	var found *history.Entry
+	// 同一文件可能上传过多次，取最近的一条
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if (idErr == nil && e.ID == id) || e.URL == args[0] || e.RemotePath == args[0] {
+			found = &entries[i]
+			break
+		}
+	}
+	if found == nil {
+		fmt.Fprintf(os.Stderr, "错误: 未找到上传记录 %s\n", args[0])
+		os.Exit(1)
+	}
+
+	fmt.Printf("编号:       #%d\n", found.ID)
+	fmt.Printf("时间:       %s\n", found.Time.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("标签:       %s\n", found.Tag)
+	fmt.Printf("本地文件:   %s\n", found.LocalFile)
+	fmt.Printf("远程路径:   %s\n", found.RemotePath)
+	fmt.Printf("URL:        %s\n", found.URL)
+	fmt.Printf("大小:       %d 字节\n", found.Size)
+	fmt.Printf("类型:       %s\n", found.ContentType)
+	fmt.Printf("MD5:        %s\n", found.MD5)
+	fmt.Printf("SHA1:       %s\n", found.SHA1)
+	if found.Skipped {
+		fmt.Println("说明:       上传时远程已存在相同文件，未重复上传")
+	}
+}
+
+// runHistoryExport 导出满足条件的全部记录
+func runHistoryExport(cmd *cobra.Command, args []string) {
+	filter, err := historyFilter()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+	entries := loadHistory(filter)
+
+	var out io.Writer = os.Stdout
+	if exportFile != "" {
+		file, err := os.Create(exportFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 无法创建导出文件: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	switch exportFormat {
+	case outputJSON, outputNDJSON:
+		writeHistoryJSON(out, entries, exportFormat == outputJSON)
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write([]string{"id", "time", "tag", "localFile", "remotePath", "url", "size", "contentType", "md5", "sha1", "skipped"})
+		for _, e := range entries {
+			w.Write([]string{
+				strconv.Itoa(e.ID), e.Time.Format(time.RFC3339), e.Tag, e.LocalFile, e.RemotePath, e.URL,
+				strconv.FormatInt(e.Size, 10), e.ContentType, e.MD5, e.SHA1, strconv.FormatBool(e.Skipped),
+			})
+		}
+		w.Flush()
+	default:
+		fmt.Fprintf(os.Stderr, "错误: 不支持的导出格式 %q，可选值为 json、ndjson、csv\n", exportFormat)
+		os.Exit(1)
+	}
+	if exportFile != "" {
+		fmt.Fprintf(os.Stderr, "已导出 %d 条记录到 %s\n", len(entries), exportFile)
+	}
+}
+
+// writeHistoryJSON 以 JSON 数组 (indent 为 true) 或每行一个对象的形式输出记录
+func writeHistoryJSON(out io.Writer, entries []history.Entry, indent bool) {
+	records := make([]historyRecord, 0, len(entries))
+	for _, e := range entries {
+		record := historyRecord{ID: e.ID, Entry: e}
+		if linkRenderer != nil {
+			record.Link, _ = linkRenderer.Render(historyLink(e))
+		}
+		records = append(records, record)
+	}
+	enc := json.NewEncoder(out)
+	if indent {
+		enc.SetIndent("", "  ")
+		enc.Encode(records)
+		return
+	}
+	for _, record := range records {
+		enc.Encode(record)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/xa1st/b2upload/internal/history"
+)
+
+// TestHistoryExportDefaultFormat 检查不指定 -o 时 export 使用 JSON，不受其他命令 --output 默认值的影响
+func TestHistoryExportDefaultFormat(t *testing.T) {
+	dir := t.TempDir()
+	historyPath := filepath.Join(dir, "b2upload.history.jsonl")
+	err := history.Open(historyPath).Append(history.Entry{
+		Time:       time.Date(2025, 11, 1, 8, 0, 0, 0, time.UTC),
+		Tag:        "custom",
+		LocalFile:  "/tmp/a.png",
+		RemotePath: "alice/a.png",
+		URL:        "https://img.example.com/alice/a.png",
+		Size:       3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("history", true)
+	viper.Set("history_file", historyPath)
+	t.Cleanup(viper.Reset)
+
+	outPath := filepath.Join(dir, "export.json")
+	rootCmd.SetArgs([]string{"history", "export", "--file", outPath})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []historyRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		t.Fatalf("导出结果不是 JSON 数组: %v\n%s", err, data)
+	}
+	if len(records) != 1 || records[0].ID != 1 || records[0].URL != "https://img.example.com/alice/a.png" {
+		t.Fatalf("导出结果不正确: %+v", records)
+	}
+}
@@ -0,0 +1,128 @@
+package b2
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ListFileVersionsResponse b2_list_file_versions 的响应
+type ListFileVersionsResponse struct {
+	Files        []UploadFileResponse `json:"files"`
+	NextFileName string               `json:"nextFileName"`
+	NextFileID   string               `json:"nextFileId"`
+}
+
+// RemoteKeys 将公开 URL 或远程路径还原为 B2 中可能的文件名，是 buildPublicURL 的逆过程。
+// 自定义域名的 URL 会去掉用户名前缀，因此返回 "用户名/路径" 和 "路径" 两个候选 (前者优先)
+func (u *Uploader) RemoteKeys(urlOrKey string) ([]string, error) {
+	if !strings.HasPrefix(urlOrKey, "http://") && !strings.HasPrefix(urlOrKey, "https://") {
+		key := strings.TrimPrefix(urlOrKey, "/")
+		if key == "" {
+			return nil, fmt.Errorf("远程路径不能为空")
+		}
+		return []string{key}, nil
+	}
+
+	// 1. 标签配置的自定义域名
+	if u.Config.URL != "" {
+		base := strings.TrimSuffix(u.Config.URL, "/") + "/"
+		if rest, ok := strings.CutPrefix(urlOrKey, base); ok {
+			key, err := decodeURLPath(rest)
+			if err != nil {
+				return nil, err
+			}
+			// 以用户名开头的文件名在生成 URL 时一定会被去掉前缀，因此 URL 路径本身以用户名开头时只有一种可能
+			if strings.HasPrefix(key, u.Config.User+"/") {
+				return []string{u.Config.User + "/" + key}, nil
+			}
+			return []string{u.Config.User + "/" + key, key}, nil
+		}
+	}
+
+	// 2. B2 官方下载地址 .../file/<bucket>/<文件名>
+	parsed, err := url.Parse(urlOrKey)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 URL %s: %w", urlOrKey, err)
+	}
+	marker := "/file/" + u.Config.Bucket + "/"
+	if i := strings.Index(parsed.EscapedPath(), marker); i >= 0 {
+		key, err := decodeURLPath(parsed.EscapedPath()[i+len(marker):])
+		if err != nil {
+			return nil, err
+		}
+		return []string{key}, nil
+	}
+	return nil, fmt.Errorf("URL %s 不属于标签 [%s] 的域名 (%s) 或 Bucket %s", urlOrKey, u.Config.Tag, u.Config.URL, u.Config.Bucket)
+}
+
+// decodeURLPath 解码 URL 路径部分 (去掉查询参数)，还原为 B2 文件名
+func decodeURLPath(p string) (string, error) {
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p = p[:i]
+	}
+	key, err := url.PathUnescape(p)
+	if err != nil {
+		return "", fmt.Errorf("无法解码 URL 路径 %s: %w", p, err)
+	}
+	if key == "" {
+		return "", fmt.Errorf("URL 中没有文件路径")
+	}
+	return key, nil
+}
+
+// FileVersions 返回指定文件名的所有版本 (包括隐藏标记)，按上传时间从新到旧排列
+func (u *Uploader) FileVersions(fileName string) ([]UploadFileResponse, error) {
+	auth := u.currentAuth()
+	if auth == nil || auth.BucketIDToUse == "" {
+		return nil, fmt.Errorf("授权信息不完整，无法列出文件版本")
+	}
+
+	var versions []UploadFileResponse
+	startName, startID := fileName, ""
+	for {
+		req := map[string]interface{}{
+			"bucketId":      auth.BucketIDToUse,
+			"startFileName": startName,
+			"prefix":        fileName,
+			"maxFileCount":  100,
+		}
+		if startID != "" {
+			req["startFileId"] = startID
+		}
+		var resp ListFileVersionsResponse
+		if err := u.apiPost("b2_list_file_versions", req, &resp); err != nil {
+			return nil, err
+		}
+		for _, f := range resp.Files {
+			if f.FileName == fileName {
+				versions = append(versions, f)
+			}
+		}
+		// 结果按文件名排序，下一页已经是其他文件时停止
+		if resp.NextFileName != fileName || resp.NextFileID == "" {
+			return versions, nil
+		}
+		startName, startID = resp.NextFileName, resp.NextFileID
+	}
+}
+
+// DeleteFileVersion 调用 b2_delete_file_version 删除一个文件版本
+func (u *Uploader) DeleteFileVersion(fileName, fileID string) error {
+	return u.apiPost("b2_delete_file_version", map[string]string{
+		"fileName": fileName,
+		"fileId":   fileID,
+	}, nil)
+}
+
+// HideFile 调用 b2_hide_file 隐藏文件：文件不再出现在文件列表中，也无法通过文件名下载，但旧版本仍然保留
+func (u *Uploader) HideFile(fileName string) error {
+	auth := u.currentAuth()
+	if auth == nil || auth.BucketIDToUse == "" {
+		return fmt.Errorf("授权信息不完整，无法隐藏文件")
+	}
+	return u.apiPost("b2_hide_file", map[string]string{
+		"bucketId": auth.BucketIDToUse,
+		"fileName": fileName,
+	}, nil)
+}
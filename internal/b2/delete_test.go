@@ -0,0 +1,100 @@
+package b2
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/xa1st/b2upload/internal/config"
+)
+
+func testUploader(customURL string) *Uploader {
+	return &Uploader{
+		Config: &config.Config{Tag: "custom", User: "alice", URL: customURL, Bucket: "pics"},
+		Auth:   &AuthResponse{DownloadURL: "https://f000.backblazeb2.com"},
+	}
+}
+
+func TestRemoteKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string // 标签的自定义域名
+		arg     string
+		want    []string
+		wantErr bool
+	}{
+		{name: "key", arg: "alice/2025/0101/a.png", want: []string{"alice/2025/0101/a.png"}},
+		{name: "key with leading slash", arg: "/alice/a.png", want: []string{"alice/a.png"}},
+		{name: "key outside user prefix", arg: "other/a.png", want: []string{"other/a.png"}},
+		{name: "empty key", arg: "/", wantErr: true},
+		{
+			name: "custom URL",
+			url:  "https://img.example.com",
+			arg:  "https://img.example.com/2025/0101/a.png",
+			want: []string{"alice/2025/0101/a.png", "2025/0101/a.png"},
+		},
+		{
+			name: "custom URL with trailing slash",
+			url:  "https://img.example.com/",
+			arg:  "https://img.example.com/a.png",
+			want: []string{"alice/a.png", "a.png"},
+		},
+		{
+			name: "custom URL starting with user name",
+			url:  "https://img.example.com",
+			arg:  "https://img.example.com/alice/a.png",
+			want: []string{"alice/alice/a.png"},
+		},
+		{
+			name: "custom URL with escapes and query",
+			url:  "https://img.example.com",
+			arg:  "https://img.example.com/my%20photo%2B1.png?v=2#top",
+			want: []string{"alice/my photo+1.png", "my photo+1.png"},
+		},
+		{name: "custom URL without path", url: "https://img.example.com", arg: "https://img.example.com/", wantErr: true},
+		{
+			name: "B2 download URL",
+			url:  "https://img.example.com",
+			arg:  "https://f000.backblazeb2.com/file/pics/alice/a%20b.png",
+			want: []string{"alice/a b.png"},
+		},
+		{name: "B2 download URL without custom domain", arg: "https://f001.backblazeb2.com/file/pics/x/y.png", want: []string{"x/y.png"}},
+		{name: "foreign URL", url: "https://img.example.com", arg: "https://evil.example.com/a.png", wantErr: true},
+		{name: "look-alike domain", url: "https://img.example.com", arg: "https://img.example.com.evil.net/a.png", wantErr: true},
+		{name: "other bucket", arg: "https://f000.backblazeb2.com/file/other/a.png", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := testUploader(tt.url).RemoteKeys(tt.arg)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: RemoteKeys(%q) = %q，期望返回错误", tt.name, tt.arg, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: RemoteKeys(%q) 出错: %v", tt.name, tt.arg, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: RemoteKeys(%q) = %q，期望 %q", tt.name, tt.arg, got, tt.want)
+		}
+	}
+}
+
+// TestRemoteKeysRoundTrip 检查由 buildPublicURL 生成的 URL 能还原出原来的文件名
+func TestRemoteKeysRoundTrip(t *testing.T) {
+	keys := []string{"alice/2025/0101/a.png", "alice/alice/a.png", "alice/中文 名+1.png", "other/a.png", "a.png"}
+	for _, customURL := range []string{"", "https://img.example.com", "https://cdn.example.com/sub/"} {
+		u := testUploader(customURL)
+		for _, key := range keys {
+			publicURL := u.buildPublicURL(key)
+			got, err := u.RemoteKeys(publicURL)
+			if err != nil {
+				t.Errorf("RemoteKeys(%q) 出错: %v", publicURL, err)
+				continue
+			}
+			if !slices.Contains(got, key) {
+				t.Errorf("RemoteKeys(%q) = %q，不包含 %q", publicURL, got, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package b2
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/xa1st/b2upload/internal/util"
+)
+
+// FindFile 查找 URL 或远程路径对应的当前可见版本 (不包括已隐藏的文件)，多个候选文件名时使用第一个存在的
+func (u *Uploader) FindFile(urlOrKey string) (*UploadFileResponse, error) {
+	keys, err := u.RemoteKeys(urlOrKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		resp, err := u.ListFileNames(key, "", key, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Files) > 0 && resp.Files[0].FileName == key && resp.Files[0].Action == "upload" {
+			return &resp.Files[0], nil
+		}
+	}
+	return nil, fmt.Errorf("B2 中不存在文件 %s", strings.Join(keys, " 或 "))
+}
+
+// OriginalName 返回上传时保存的原始文件名，没有保存时返回空字符串。
+// 只解码按 encodeFileName 编码过的值，其他工具保存的未编码文件名 (例如包含 % 或空格) 原样使用
+func OriginalName(file *UploadFileResponse) string {
+	name := file.FileInfo[FileInfoOriginalName]
+	if decoded, err := url.PathUnescape(name); err == nil && encodeFileName(decoded) == name {
+		name = decoded
+	}
+	// 只取文件名部分，避免文件信息中的路径写到目标目录之外
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	if name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
+
+// SHA1 返回文件内容的 SHA1：小文件为 contentSha1，大文件为上传时保存的 large_file_sha1，都没有时返回空字符串
+func (f *UploadFileResponse) SHA1() string {
+	sha := f.ContentSha1
+	if sha == "" || sha == "none" {
+		sha = f.FileInfo["large_file_sha1"]
+	}
+	return strings.ToLower(strings.TrimPrefix(sha, "unverified:"))
+}
+
+// Download 通过 b2_download_file_by_id 下载文件到 dest。数据先写入 dest.part，
+// 中断后再次下载时用 Range 请求从已下载的位置继续，完成后校验 SHA1 再重命名为 dest
+func (u *Uploader) Download(file *UploadFileResponse, dest string) error {
+	partPath := dest + ".part"
+	err := u.withRetry("下载 "+file.FileName, isTemporary, func() error {
+		return u.downloadRange(file, partPath)
+	})
+	if err != nil {
+		return err
+	}
+
+	want := file.SHA1()
+	if want == "" {
+		fmt.Fprintf(u.Log, "警告：%s 没有保存 SHA1，跳过校验\n", file.FileName)
+	} else {
+		got, err := fileSha1(partPath)
+		if err != nil {
+			return err
+		}
+		if got != want {
+			// 已下载的数据不可信，删除后下次重新下载
+			os.Remove(partPath)
+			return fmt.Errorf("%s SHA1 校验失败 (期望 %s，实际 %s)", file.FileName, want, got)
+		}
+	}
+	if err := os.Rename(partPath, dest); err != nil {
+		return fmt.Errorf("无法保存下载文件 %s: %w", dest, err)
+	}
+	return nil
+}
+
+// downloadRange 从 partPath 当前的大小开始下载剩余的数据并追加到文件末尾
+func (u *Uploader) downloadRange(file *UploadFileResponse, partPath string) error {
+	out, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return &permanentError{fmt.Errorf("无法创建下载文件 %s: %w", partPath, err)}
+	}
+	defer out.Close()
+	offset, err := out.Seek(0, io.SeekEnd)
+	if err != nil {
+		return &permanentError{fmt.Errorf("无法读取下载文件 %s: %w", partPath, err)}
+	}
+	if offset == file.ContentLength {
+		return nil
+	}
+	if offset > file.ContentLength {
+		// 与远程文件大小不符，重新下载
+		if err := out.Truncate(0); err != nil {
+			return &permanentError{fmt.Errorf("无法重置下载文件 %s: %w", partPath, err)}
+		}
+		offset, _ = out.Seek(0, io.SeekStart)
+	}
+
+	auth := u.currentAuth()
+	if auth == nil {
+		return &permanentError{fmt.Errorf("尚未授权 B2 账户")}
+	}
+	req, err := http.NewRequest("GET", auth.DownloadURL+"/b2api/v3/b2_download_file_by_id?fileId="+url.QueryEscape(file.FileID), nil)
+	if err != nil {
+		return &permanentError{fmt.Errorf("创建下载请求失败: %w", err)}
+	}
+	req.Header.Set("Authorization", auth.AuthorizationToken)
+	if offset > 0 {
+		fmt.Fprintf(u.Log, "从 %s 处继续下载 %s\n", util.FormatSize(offset), file.FileName)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := u.UploadClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("b2_download_file_by_id 网络请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// 服务器忽略了 Range，从头写入
+		if offset > 0 {
+			if err := out.Truncate(0); err != nil {
+				return &permanentError{fmt.Errorf("无法重置下载文件 %s: %w", partPath, err)}
+			}
+			out.Seek(0, io.SeekStart)
+		}
+	default:
+		return newAPIError("b2_download_file_by_id", resp)
+	}
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		// 已写入的数据保留在 .part 文件中，重试时继续
+		return fmt.Errorf("b2_download_file_by_id 网络请求失败: %w", &url.Error{Op: "GET", URL: req.URL.String(), Err: err})
+	}
+	return nil
+}
+
+// fileSha1 计算本地文件的 SHA1
+func fileSha1(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("无法读取下载文件 %s: %w", path, err)
+	}
+	defer file.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("无法读取下载文件 %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
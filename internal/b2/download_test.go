@@ -0,0 +1,48 @@
+package b2
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOriginalName(t *testing.T) {
+	tests := []struct {
+		stored string
+		want   string
+	}{
+		{"a.png", "a.png"},
+		{"my%20photo%25.png", "my photo%.png"},
+		{"%E4%B8%AD%E6%96%87.png", "中文.png"},
+		{"100%.png", "100%.png"},    // 其他工具保存的未编码文件名
+		{"a b.png", "a b.png"},      // 未编码的空格
+		{"dir/sub/a.png", "a.png"},  // 只取文件名
+		{`C:\Users\a.png`, "a.png"}, // Windows 路径
+		{"..", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		file := &UploadFileResponse{FileInfo: map[string]string{FileInfoOriginalName: tt.stored}}
+		if got := OriginalName(file); got != tt.want {
+			t.Errorf("OriginalName(%q) = %q，期望 %q", tt.stored, got, tt.want)
+		}
+	}
+}
+
+// TestOriginalNameRoundTrip 检查上传时保存的原始文件名 (普通上传和大文件上传相同) 能被还原
+func TestOriginalNameRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"plain.png", "100% done.png", "a+b%2F.png", "中文 名字.jpg", "x%20y.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		info := fileInfo(path)
+		if info[FileInfoLastModified] == "" {
+			t.Errorf("%s: 缺少 %s", name, FileInfoLastModified)
+		}
+		if got := OriginalName(&UploadFileResponse{FileInfo: info}); got != name {
+			t.Errorf("保存 %q 后还原为 %q", name, got)
+		}
+	}
+}
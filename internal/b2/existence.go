@@ -0,0 +1,135 @@
+package b2
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// MaxListPageSize 是每次 b2_list_file_names 请求返回的文件数，超过 1000 时 B2 会按多次请求计费
+	MaxListPageSize = 1000
+	// maxPrefixListPages 单个前缀最多列出的页数，超过后回退为逐个文件检查
+	maxPrefixListPages = 10
+)
+
+// existingFiles 记录按目录前缀批量列出的远程文件，用于代替逐个文件的存在性检查
+type existingFiles struct {
+	prefixes map[string]map[string]UploadFileResponse // 前缀 -> 该前缀下已存在的文件名及其信息
+}
+
+// lookup 查询远程文件，不存在时 file 为 nil；known 为 false 表示该文件的前缀未被列出，需要单独检查
+func (e *existingFiles) lookup(remotePath string) (file *UploadFileResponse, known bool) {
+	if e == nil {
+		return nil, false
+	}
+	files, ok := e.prefixes[remotePrefix(remotePath)]
+	if !ok {
+		return nil, false
+	}
+	if f, ok := files[remotePath]; ok {
+		return &f, true
+	}
+	return nil, true
+}
+
+// sameContent 判断远程文件与待上传文件的内容是否一致：大小不同一定不一致，远程记录了 SHA1 时比较 SHA1。
+// 旧版本以 do_not_verify 上传的文件没有 SHA1，此时只比较大小 (默认模板的文件名中已包含内容的 MD5，同名即内容相同)
+func sameContent(file *UploadFileResponse, job *uploadJob) bool {
+	if file.ContentLength != job.hashes.Size {
+		return false
+	}
+	if sha := file.SHA1(); sha != "" {
+		return sha == job.hashes.SHA1
+	}
+	return true
+}
+
+// remotePrefix 返回远程路径所在的“目录”前缀 (包含结尾的 /)，没有目录时返回空字符串
+func remotePrefix(remotePath string) string {
+	if i := strings.LastIndex(remotePath, "/"); i >= 0 {
+		return remotePath[:i+1]
+	}
+	return ""
+}
+
+// listExistingFiles 按远程路径的目录前缀分组，每个前缀分页列出一次已存在的文件。
+// 列出某个前缀所需的请求数超过该前缀下待上传文件数 (或上限) 时放弃，改为逐个检查更省请求
+func (u *Uploader) listExistingFiles(jobs []*uploadJob) *existingFiles {
+	counts := make(map[string]int)
+	var order []string
+	for _, job := range jobs {
+		prefix := remotePrefix(job.remotePath)
+		if counts[prefix] == 0 {
+			order = append(order, prefix)
+		}
+		counts[prefix]++
+	}
+
+	existing := &existingFiles{prefixes: make(map[string]map[string]UploadFileResponse)}
+	for _, prefix := range order {
+		// 只有一个文件时，单独检查与列出前缀的请求数相同，且不受前缀下文件数量影响
+		if counts[prefix] < 2 {
+			continue
+		}
+		maxPages := counts[prefix]
+		if maxPages > maxPrefixListPages {
+			maxPages = maxPrefixListPages
+		}
+		files, err := u.listPrefix(prefix, maxPages)
+		if err != nil {
+			fmt.Fprintf(u.Log, "警告：批量检查前缀 %s 下已存在的文件失败，将逐个检查: %v\n", prefix, err)
+			continue
+		}
+		if files == nil {
+			fmt.Fprintf(u.Log, "前缀 %s 下文件较多，改为逐个检查文件是否存在\n", prefix)
+			continue
+		}
+		existing.prefixes[prefix] = files
+	}
+	return existing
+}
+
+// ListFileNames 调用一次 b2_list_file_names，从 startFileName (为空时从头开始) 列出 prefix 下最多 maxCount 个文件。
+// delimiter 为 "/" 时只列出当前“目录”，子目录以 Action 为 folder 的条目返回
+func (u *Uploader) ListFileNames(prefix, delimiter, startFileName string, maxCount int) (*ListFileNamesResponse, error) {
+	auth := u.currentAuth()
+	if auth == nil || auth.BucketIDToUse == "" {
+		return nil, fmt.Errorf("授权信息不完整，无法列出文件")
+	}
+	body := map[string]interface{}{
+		"bucketId":     auth.BucketIDToUse,
+		"prefix":       prefix,
+		"maxFileCount": maxCount,
+	}
+	if delimiter != "" {
+		body["delimiter"] = delimiter
+	}
+	if startFileName != "" {
+		body["startFileName"] = startFileName
+	}
+	var listResp ListFileNamesResponse
+	if err := u.apiPost("b2_list_file_names", body, &listResp); err != nil {
+		return nil, err
+	}
+	return &listResp, nil
+}
+
+// listPrefix 分页列出指定前缀下的所有文件 (文件名 -> 文件信息)，页数超过 maxPages 时返回 nil
+func (u *Uploader) listPrefix(prefix string, maxPages int) (map[string]UploadFileResponse, error) {
+	files := make(map[string]UploadFileResponse)
+	startFileName := ""
+	for page := 1; page <= maxPages; page++ {
+		listResp, err := u.ListFileNames(prefix, "", startFileName, MaxListPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range listResp.Files {
+			files[file.FileName] = file
+		}
+		if listResp.NextFileName == "" {
+			return files, nil
+		}
+		startFileName = listResp.NextFileName
+	}
+	return nil, nil
+}
@@ -0,0 +1,193 @@
+package b2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xa1st/b2upload/internal/util"
+)
+
+func TestSameContent(t *testing.T) {
+	const sha = "aaaaaaaaaabbbbbbbbbbccccccccccdddddddddd"
+	job := &uploadJob{remotePath: "alice/a.png", hashes: &util.FileHashes{Size: 10, SHA1: sha}}
+	tests := []struct {
+		name   string
+		remote UploadFileResponse
+		want   bool
+	}{
+		{"same size and SHA1", UploadFileResponse{ContentLength: 10, ContentSha1: sha}, true},
+		{"different SHA1", UploadFileResponse{ContentLength: 10, ContentSha1: "0000000000000000000000000000000000000000"}, false},
+		{"different size", UploadFileResponse{ContentLength: 11, ContentSha1: sha}, false},
+		{"unverified SHA1", UploadFileResponse{ContentLength: 10, ContentSha1: "unverified:" + sha}, true},
+		{"large file SHA1", UploadFileResponse{ContentLength: 10, ContentSha1: "none", FileInfo: map[string]string{"large_file_sha1": sha}}, true},
+		{"do_not_verify upload with same size", UploadFileResponse{ContentLength: 10, ContentSha1: "none"}, true},
+		{"do_not_verify upload with different size", UploadFileResponse{ContentLength: 9, ContentSha1: "none"}, false},
+		{"large file without SHA1", UploadFileResponse{ContentLength: 10, ContentSha1: "none", FileInfo: map[string]string{}}, true},
+	}
+	for _, tt := range tests {
+		if got := sameContent(&tt.remote, job); got != tt.want {
+			t.Errorf("%s: sameContent = %v，期望 %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// fakeFileNames 在 fakeB2 上模拟 b2_list_file_names，files 为已存在的文件
+func fakeFileNames(f *fakeB2, files []UploadFileResponse) {
+	sort.Slice(files, func(i, j int) bool { return files[i].FileName < files[j].FileName })
+	f.handle("b2_list_file_names", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Prefix        string
+			StartFileName string
+			MaxFileCount  int
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var resp ListFileNamesResponse
+		for _, file := range files {
+			if file.FileName < req.StartFileName || !strings.HasPrefix(file.FileName, req.Prefix) {
+				continue
+			}
+			if len(resp.Files) == req.MaxFileCount {
+				resp.NextFileName = file.FileName
+				break
+			}
+			resp.Files = append(resp.Files, file)
+		}
+		writeJSON(w, resp)
+	})
+}
+
+// remoteJobs 返回远程路径为 paths 的上传任务 (内容均为 "x")
+func remoteJobs(paths ...string) []*uploadJob {
+	var jobs []*uploadJob
+	for _, p := range paths {
+		jobs = append(jobs, &uploadJob{remotePath: p, hashes: &util.FileHashes{Size: 1}})
+	}
+	return jobs
+}
+
+func TestListExistingFiles(t *testing.T) {
+	f := newFakeB2(t)
+	var files []UploadFileResponse
+	for _, name := range []string{"alice/2025/a.png", "alice/2025/b.png", "alice/2025/sub/c.png", "alice/other/a.png", "bob/2025/a.png"} {
+		files = append(files, UploadFileResponse{FileName: name, ContentLength: 1})
+	}
+	// 2500 个文件需要 3 页
+	for i := 0; i < 2500; i++ {
+		files = append(files, UploadFileResponse{FileName: fmt.Sprintf("alice/many/%04d.png", i), ContentLength: 1})
+	}
+	fakeFileNames(f, files)
+	u := f.authorizedUploader()
+
+	tests := []struct {
+		name      string
+		jobs      []*uploadJob
+		wantCalls int
+		listed    []string // 被批量列出的前缀
+	}{
+		{name: "one prefix", jobs: remoteJobs("alice/2025/a.png", "alice/2025/new.png", "alice/2025/c.png"), wantCalls: 1, listed: []string{"alice/2025/"}},
+		{name: "single file prefix", jobs: remoteJobs("alice/2025/a.png", "alice/solo/a.png"), wantCalls: 0},
+		{name: "two prefixes", jobs: remoteJobs("alice/2025/a.png", "alice/2025/x.png", "alice/other/a.png", "alice/other/x.png", "alice/x.png"), wantCalls: 2, listed: []string{"alice/2025/", "alice/other/"}},
+		{name: "too many pages", jobs: remoteJobs("alice/many/0001.png", "alice/many/x.png"), wantCalls: 2},
+		{name: "enough files to page", jobs: remoteJobs("alice/many/0001.png", "alice/many/2400.png", "alice/many/x.png"), wantCalls: 3, listed: []string{"alice/many/"}},
+	}
+	for _, tt := range tests {
+		before := f.count("b2_list_file_names")
+		existing := u.listExistingFiles(tt.jobs)
+		if n := f.count("b2_list_file_names") - before; n != tt.wantCalls {
+			t.Errorf("%s: b2_list_file_names 调用 %d 次，期望 %d 次", tt.name, n, tt.wantCalls)
+		}
+		var listed []string
+		for prefix := range existing.prefixes {
+			listed = append(listed, prefix)
+		}
+		sort.Strings(listed)
+		if !slices.Equal(listed, tt.listed) {
+			t.Errorf("%s: 批量列出的前缀 %q，期望 %q", tt.name, listed, tt.listed)
+		}
+	}
+
+	existing := u.listExistingFiles(remoteJobs("alice/2025/a.png", "alice/2025/new.png", "alice/solo/a.png"))
+	lookups := []struct {
+		path   string
+		exists bool
+		known  bool
+	}{
+		{"alice/2025/a.png", true, true},
+		{"alice/2025/new.png", false, true},
+		{"alice/2025/sub/c.png", false, false}, // 子目录中的文件按自己所在的前缀查找
+		{"alice/solo/a.png", false, false},
+	}
+	for _, tt := range lookups {
+		file, known := existing.lookup(tt.path)
+		if (file != nil) != tt.exists || known != tt.known {
+			t.Errorf("lookup(%q) = %v, %v，期望存在 %v, %v", tt.path, file != nil, known, tt.exists, tt.known)
+		}
+	}
+}
+
+// TestListExistingFilesError 检查批量列出失败时改为逐个检查
+func TestListExistingFilesError(t *testing.T) {
+	f := newFakeB2(t)
+	f.handle("b2_list_file_names", func(w http.ResponseWriter, r *http.Request) {
+		writeB2Error(w, http.StatusBadRequest, "bad_request", "invalid prefix", "")
+	})
+	u := f.authorizedUploader()
+	existing := u.listExistingFiles(remoteJobs("alice/2025/a.png", "alice/2025/b.png"))
+	if _, known := existing.lookup("alice/2025/a.png"); known {
+		t.Error("批量列出失败时 lookup 仍返回 known")
+	}
+}
+
+// TestUploadFilesUsesPrefixList 检查上传同一目录下的多个文件时只列出一次前缀，不再逐个检查
+func TestUploadFilesUsesPrefixList(t *testing.T) {
+	f := newFakeB2(t)
+	dir := t.TempDir()
+	var sources []util.SourceFile
+	for _, name := range []string{"a.png", "b.png", "c.png"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("data "+name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, util.SourceFile{Path: path, Rel: name})
+	}
+	existingHashes, err := util.HashFile(sources[0].Path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeFileNames(f, []UploadFileResponse{{FileName: "alice/a.png", ContentLength: existingHashes.Size, ContentSha1: existingHashes.SHA1}})
+	f.handle("b2_get_upload_url", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, UploadURLResponse{UploadURL: f.URL + "/b2_upload_file", UploadAuthorizationToken: "upload-token"})
+	})
+	f.handle("b2_upload_file", func(w http.ResponseWriter, r *http.Request) {
+		length, _ := strconv.ParseInt(r.Header.Get("Content-Length"), 10, 64)
+		io.Copy(io.Discard, r.Body)
+		writeJSON(w, UploadFileResponse{FileName: r.Header.Get("X-Bz-File-Name"), ContentLength: length, ContentSha1: r.Header.Get("X-Bz-Content-Sha1")})
+	})
+
+	u := f.authorizedUploader()
+	u.Config.SetPreservePaths()
+	results := u.UploadFiles(sources)
+	for i, res := range results {
+		if res.Error != nil {
+			t.Fatalf("%s 上传出错: %v", res.LocalFile, res.Error)
+		}
+		if wantSkipped := i == 0; res.Skipped != wantSkipped {
+			t.Errorf("%s: Skipped = %v，期望 %v", res.RemotePath, res.Skipped, wantSkipped)
+		}
+	}
+	if n := f.count("b2_list_file_names"); n != 1 {
+		t.Errorf("b2_list_file_names 调用 %d 次，期望 1 次", n)
+	}
+	if n := f.count("b2_upload_file"); n != 2 {
+		t.Errorf("b2_upload_file 调用 %d 次，期望 2 次", n)
+	}
+}
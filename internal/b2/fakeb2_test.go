@@ -0,0 +1,113 @@
+package b2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xa1st/b2upload/internal/config"
+)
+
+// fakeB2 是用于测试的 B2 API 服务：b2_authorize_account 每次返回新的 Token (auth-1、auth-2…)，
+// 其他接口由测试通过 handle 设置，未设置的接口返回 404
+type fakeB2 struct {
+	*httptest.Server
+	t *testing.T
+
+	mu       sync.Mutex
+	calls    map[string]int // 接口名 -> 调用次数
+	handlers map[string]http.HandlerFunc
+}
+
+const fakeBucketID = "bucket-id"
+
+func newFakeB2(t *testing.T) *fakeB2 {
+	f := &fakeB2{t: t, calls: make(map[string]int), handlers: make(map[string]http.HandlerFunc)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	f.handle("b2_authorize_account", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"authorizationToken": "auth-" + strconv.Itoa(f.count("b2_authorize_account")),
+			"apiUrl":             f.URL,
+			"downloadUrl":        f.URL,
+			"apiInfo":            map[string]interface{}{"storageApi": map[string]string{"bucketId": fakeBucketID}},
+		})
+	})
+	return f
+}
+
+// serve 按请求路径的最后一段 (接口名) 分发请求
+func (f *fakeB2) serve(w http.ResponseWriter, r *http.Request) {
+	api := path.Base(r.URL.Path)
+	f.mu.Lock()
+	f.calls[api]++
+	handler := f.handlers[api]
+	f.mu.Unlock()
+	if handler == nil {
+		writeB2Error(w, http.StatusNotFound, "not_found", "未设置的接口 "+api, "")
+		return
+	}
+	handler(w, r)
+}
+
+// handle 设置接口的处理函数
+func (f *fakeB2) handle(api string, handler http.HandlerFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[api] = handler
+}
+
+// count 返回接口被调用的次数
+func (f *fakeB2) count(api string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[api]
+}
+
+// uploader 返回指向 fakeB2 的 Uploader，重试等待时间缩短为毫秒级
+func (f *fakeB2) uploader() *Uploader {
+	cfg, err := config.NewConfig("custom", "alice", "https://img.example.com", "key-id:key", "pics")
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if err := cfg.SetAPIURL(f.URL); err != nil {
+		f.t.Fatal(err)
+	}
+	if err := cfg.SetRetryOptions(3, time.Millisecond, 5*time.Millisecond); err != nil {
+		f.t.Fatal(err)
+	}
+	u := NewUploader(cfg)
+	u.Log = io.Discard
+	return u
+}
+
+// authorizedUploader 返回已完成授权的 Uploader
+func (f *fakeB2) authorizedUploader() *Uploader {
+	u := f.uploader()
+	if err := u.AuthorizeAccount(); err != nil {
+		f.t.Fatal(err)
+	}
+	return u
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeB2Error 按 B2 的格式返回错误响应，retryAfter 不为空时设置 Retry-After 响应头
+func writeB2Error(w http.ResponseWriter, status int, code, message, retryAfter string) {
+	if retryAfter != "" {
+		w.Header().Set("Retry-After", retryAfter)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"status": %d, "code": %q, "message": %q}`, status, code, message)
+}
@@ -0,0 +1,421 @@
+package b2
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/xa1st/b2upload/internal/util"
+)
+
+// --- B2 大文件 API 响应结构体 ---
+
+// StartLargeFileResponse b2_start_large_file 的响应
+type StartLargeFileResponse struct {
+	FileID   string `json:"fileId"`
+	FileName string `json:"fileName"`
+}
+
+// UploadPartURLResponse b2_get_upload_part_url 的响应
+type UploadPartURLResponse struct {
+	FileID                   string `json:"fileId"`
+	UploadURL                string `json:"uploadUrl"`          // 分片上传专用的 URL
+	UploadAuthorizationToken string `json:"authorizationToken"` // 分片上传专用的 Token
+}
+
+// UploadPartResponse b2_upload_part 的响应
+type UploadPartResponse struct {
+	FileID        string `json:"fileId"`
+	PartNumber    int    `json:"partNumber"`
+	ContentLength int64  `json:"contentLength"`
+	ContentSha1   string `json:"contentSha1"`
+}
+
+// ListPartsResponse b2_list_parts 的响应
+type ListPartsResponse struct {
+	Parts          []UploadPartResponse `json:"parts"`
+	NextPartNumber *int                 `json:"nextPartNumber"`
+}
+
+// maxPartCount 是 B2 单个大文件允许的最大分片数
+const maxPartCount = 10000
+
+// partSizeFor 根据文件大小计算分片大小，保证分片数不超过 B2 的上限
+func (u *Uploader) partSizeFor(size int64) int64 {
+	partSize := u.Config.PartSize
+	if (size+partSize-1)/partSize > maxPartCount {
+		partSize = (size + maxPartCount - 1) / maxPartCount
+	}
+	return partSize
+}
+
+// startLargeFile 调用 b2_start_large_file 创建一个未完成的大文件
+// 整个文件的 SHA1 按 B2 的约定保存在 large_file_sha1 文件信息中
+func (u *Uploader) startLargeFile(remotePath, contentType, contentSha1 string, fileInfo map[string]string) (*StartLargeFileResponse, error) {
+	info := map[string]string{"large_file_sha1": contentSha1}
+	for k, v := range fileInfo {
+		info[k] = v
+	}
+	var startResp StartLargeFileResponse
+	err := u.apiPost("b2_start_large_file", map[string]interface{}{
+		"bucketId":    u.currentAuth().BucketIDToUse,
+		"fileName":    remotePath,
+		"contentType": contentType,
+		"fileInfo":    info,
+	}, &startResp)
+	if err != nil {
+		return nil, err
+	}
+	return &startResp, nil
+}
+
+// getUploadPartURL 获取分片上传专用的 URL 和 Token，每个分片工作协程需要独立获取
+func (u *Uploader) getUploadPartURL(fileID string) (*UploadPartURLResponse, error) {
+	var partURL UploadPartURLResponse
+	if err := u.apiPost("b2_get_upload_part_url", map[string]string{"fileId": fileID}, &partURL); err != nil {
+		return nil, err
+	}
+	return &partURL, nil
+}
+
+// finishLargeFile 调用 b2_finish_large_file，按分片顺序提交每个分片的 SHA1
+func (u *Uploader) finishLargeFile(fileID string, partSha1s []string) error {
+	return u.apiPost("b2_finish_large_file", map[string]interface{}{
+		"fileId":        fileID,
+		"partSha1Array": partSha1s,
+	}, nil)
+}
+
+// cancelLargeFile 调用 b2_cancel_large_file，删除未完成大文件已上传的分片
+func (u *Uploader) cancelLargeFile(fileID string) error {
+	return u.apiPost("b2_cancel_large_file", map[string]string{"fileId": fileID}, nil)
+}
+
+// listParts 调用 b2_list_parts 分页列出未完成大文件已上传的分片：分片号 -> SHA1
+func (u *Uploader) listParts(fileID string) (map[int]string, error) {
+	parts := make(map[int]string)
+	startPartNumber := 1
+	for {
+		var listResp ListPartsResponse
+		err := u.apiPost("b2_list_parts", map[string]interface{}{
+			"fileId":          fileID,
+			"startPartNumber": startPartNumber,
+			"maxPartCount":    1000,
+		}, &listResp)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range listResp.Parts {
+			parts[part.PartNumber] = part.ContentSha1
+		}
+		if listResp.NextPartNumber == nil {
+			return parts, nil
+		}
+		startPartNumber = *listResp.NextPartNumber
+	}
+}
+
+// partSha1 计算本地文件中某个分片的 SHA1
+func partSha1(file *os.File, offset, length int64) (string, error) {
+	hash := sha1.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(file, offset, length)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// uploadPart 上传单个分片，返回分片的 SHA1
+func (u *Uploader) uploadPart(file *os.File, partNumber int, offset, length int64, partURL *UploadPartURLResponse) (string, error) {
+	// 先读取一遍分片计算 SHA1，B2 会用它校验收到的数据
+	sum, err := partSha1(file, offset, length)
+	if err != nil {
+		return "", fmt.Errorf("计算分片 %d 的 SHA1 失败: %w", partNumber, err)
+	}
+
+	req, err := http.NewRequest("POST", partURL.UploadURL, io.NewSectionReader(file, offset, length))
+	if err != nil {
+		return "", fmt.Errorf("创建分片 %d 上传请求失败: %w", partNumber, err)
+	}
+
+	req.Header.Set("Authorization", partURL.UploadAuthorizationToken)
+	req.Header.Set("X-Bz-Part-Number", strconv.Itoa(partNumber))
+	req.Header.Set("X-Bz-Content-Sha1", sum)
+	req.ContentLength = length
+
+	resp, err := u.send("b2_upload_part", u.UploadClient, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var partResp UploadPartResponse
+	if err := json.NewDecoder(resp.Body).Decode(&partResp); err != nil {
+		return "", fmt.Errorf("解析分片 %d 上传响应失败: %w", partNumber, err)
+	}
+	if partResp.ContentSha1 != sum || partResp.ContentLength != length {
+		return "", fmt.Errorf("%w: 分片 %d 本地 SHA1 %s (%d 字节)，B2 保存的 SHA1 %s (%d 字节)",
+			ErrChecksumMismatch, partNumber, sum, length, partResp.ContentSha1, partResp.ContentLength)
+	}
+	return sum, nil
+}
+
+// uploadPartWithRetry 使用工作协程自己的分片上传 URL 上传单个分片，URL 失效时重新获取并重试
+func (u *Uploader) uploadPartWithRetry(file *os.File, fileID string, partNumber int, offset, length int64, partURL **UploadPartURLResponse) (string, error) {
+	var sum string
+	err := u.withRetry(fmt.Sprintf("上传分片 %d", partNumber), needNewUploadURL, func() error {
+		if *partURL == nil {
+			info, err := u.getUploadPartURL(fileID)
+			if err != nil {
+				return &permanentError{fmt.Errorf("获取分片上传URL失败: %w", err)}
+			}
+			*partURL = info
+		}
+
+		var err error
+		sum, err = u.uploadPart(file, partNumber, offset, length, *partURL)
+		if err != nil && needNewUploadURL(err) {
+			*partURL = nil
+		}
+		return err
+	})
+	return sum, err
+}
+
+// prepareLargeFile 查找可继续上传的状态记录；没有可用记录时创建新的大文件。
+// 返回的状态记录中 Parts 只包含已确认存在于 B2 中的分片
+func (u *Uploader) prepareLargeFile(file *os.File, key string, entry *LargeFileState, contentType string) (*LargeFileState, error) {
+	if u.State != nil {
+		if saved := u.State.Get(key); saved != nil && saved.Bucket == u.Config.Bucket && saved.Size == entry.Size {
+			uploaded, err := u.listParts(saved.FileID)
+			if err == nil {
+				saved.Parts = u.verifiedParts(file, saved, uploaded)
+				fmt.Fprintf(u.Log, "继续上传未完成的大文件 %s (已完成 %d 个分片)\n", saved.RemotePath, len(saved.Parts))
+				return saved, nil
+			}
+			// 网络错误、服务端错误等：保留状态记录，稍后可以继续上传，避免留下无人管理的未完成大文件
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || !apiErr.FileGone() {
+				return nil, fmt.Errorf("查询 %s 已上传的分片失败 (上传进度已保留，可稍后重试): %w", saved.RemotePath, err)
+			}
+			// fileId 已失效 (被取消、已完成或已过期)：先确保旧文件已取消，再丢弃旧记录重新上传
+			fmt.Fprintf(u.Log, "警告：无法继续上传 %s，将重新上传: %v\n", saved.RemotePath, err)
+			if err := u.cancelLargeFile(saved.FileID); err != nil && (!errors.As(err, &apiErr) || !apiErr.FileGone()) {
+				return nil, fmt.Errorf("取消未完成的大文件 %s 失败 (上传进度已保留，可稍后重试): %w", saved.RemotePath, err)
+			}
+			if err := u.State.Delete(key); err != nil {
+				fmt.Fprintf(u.Log, "警告：%v\n", err)
+			}
+		}
+	}
+
+	startResp, err := u.startLargeFile(entry.RemotePath, contentType, entry.ContentSha1, fileInfo(entry.LocalFile))
+	if err != nil {
+		return nil, fmt.Errorf("创建大文件失败: %w", err)
+	}
+	entry.FileID = startResp.FileID
+	entry.Parts = make(map[int]string)
+	if u.State != nil {
+		if err := u.State.Put(key, entry); err != nil {
+			fmt.Fprintf(u.Log, "警告：%v\n", err)
+		}
+	}
+	return entry, nil
+}
+
+// verifiedParts 对比 B2 中已上传的分片和本地分片的 SHA1，只保留内容一致的分片
+func (u *Uploader) verifiedParts(file *os.File, entry *LargeFileState, uploaded map[int]string) map[int]string {
+	parts := make(map[int]string)
+	for partNumber, remoteSha1 := range uploaded {
+		localSha1, ok := entry.Parts[partNumber]
+		if !ok {
+			// 分片已上传但进程在记录前中断，重新计算本地分片的 SHA1 进行确认
+			offset := int64(partNumber-1) * entry.PartSize
+			length := entry.PartSize
+			if offset >= entry.Size {
+				continue
+			}
+			if offset+length > entry.Size {
+				length = entry.Size - offset
+			}
+			sum, err := partSha1(file, offset, length)
+			if err != nil {
+				continue
+			}
+			localSha1 = sum
+		}
+		if localSha1 == remoteSha1 {
+			parts[partNumber] = remoteSha1
+		}
+	}
+	return parts
+}
+
+// uploadLargeFile 使用 B2 大文件接口 (start/part/finish) 并发上传单个大文件。
+// 如果存在该文件未完成的上传记录，则跳过已上传的分片继续上传，返回实际使用的远程路径
+func (u *Uploader) uploadLargeFile(file *os.File, job *uploadJob) (string, error) {
+	absPath, err := filepath.Abs(job.localFile)
+	if err != nil {
+		absPath = job.localFile
+	}
+	// 以本地路径和内容 MD5 作为状态记录的键，文件内容变化后不会误用旧的分片
+	key := StateKey(absPath, job.hashes.MD5)
+	size := job.hashes.Size
+
+	entry, err := u.prepareLargeFile(file, key, &LargeFileState{
+		Tag:         u.Config.Tag,
+		LocalFile:   absPath,
+		ContentMD5:  job.hashes.MD5,
+		ContentSha1: job.hashes.SHA1,
+		Size:        size,
+		Bucket:      u.Config.Bucket,
+		RemotePath:  job.remotePath,
+		PartSize:    u.partSizeFor(size),
+	}, job.contentType)
+	if err != nil {
+		return "", err
+	}
+
+	partSize := entry.PartSize
+	partCount := int((size + partSize - 1) / partSize)
+	fmt.Fprintf(u.Log, "大文件 %s 共 %d 个分片 (每片 %d MB)，开始分片上传...\n", entry.RemotePath, partCount, partSize/1024/1024)
+
+	partSha1s := make([]string, partCount)
+	parts := make(chan int, partCount)
+	for i := 1; i <= partCount; i++ {
+		if sum, ok := entry.Parts[i]; ok {
+			partSha1s[i-1] = sum
+			continue
+		}
+		parts <- i
+	}
+	close(parts)
+
+	numWorkers := u.Config.PartConcurrency
+	if len(parts) < numWorkers {
+		numWorkers = len(parts)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	setErr := func(err error) {
+		errMu.Lock()
+		defer errMu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	failed := func() bool {
+		errMu.Lock()
+		defer errMu.Unlock()
+		return firstErr != nil
+	}
+
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// B2 要求每个协程使用独立的分片上传 URL
+			var partURL *UploadPartURLResponse
+			for partNumber := range parts {
+				// 已有分片失败时不再继续上传剩余分片
+				if failed() {
+					continue
+				}
+				offset := int64(partNumber-1) * partSize
+				length := partSize
+				if offset+length > size {
+					length = size - offset
+				}
+				sum, err := u.uploadPartWithRetry(file, entry.FileID, partNumber, offset, length, &partURL)
+				if err != nil {
+					setErr(err)
+					continue
+				}
+				partSha1s[partNumber-1] = sum
+				if u.State != nil {
+					if err := u.State.RecordPart(key, partNumber, sum); err != nil {
+						fmt.Fprintf(u.Log, "警告：%v\n", err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		if u.State != nil {
+			// 保留未完成的大文件，下次运行或 b2upload resume 时继续上传
+			return "", fmt.Errorf("%w (进度已保存，可使用 b2upload resume 继续上传)", firstErr)
+		}
+		// 取消未完成的大文件，避免残留分片继续占用存储空间
+		if cancelErr := u.cancelLargeFile(entry.FileID); cancelErr != nil {
+			fmt.Fprintf(u.Log, "警告：取消未完成的大文件失败 (%s): %v\n", entry.RemotePath, cancelErr)
+		}
+		return "", firstErr
+	}
+
+	if err := u.finishLargeFile(entry.FileID, partSha1s); err != nil {
+		return "", fmt.Errorf("合并大文件分片失败: %w", err)
+	}
+	if u.State != nil {
+		if err := u.State.Delete(key); err != nil {
+			fmt.Fprintf(u.Log, "警告：%v\n", err)
+		}
+	}
+	return entry.RemotePath, nil
+}
+
+// ResumeLargeFile 根据状态记录继续上传一个未完成的大文件，返回公开 URL
+func (u *Uploader) ResumeLargeFile(entry *LargeFileState) (string, error) {
+	file, err := os.Open(entry.LocalFile)
+	if err != nil {
+		return "", fmt.Errorf("无法打开本地文件 %s: %w", entry.LocalFile, err)
+	}
+	defer file.Close()
+
+	hashes, err := util.HashFile(entry.LocalFile, false)
+	if err != nil {
+		return "", err
+	}
+	if hashes.MD5 != entry.ContentMD5 || hashes.Size != entry.Size {
+		return "", fmt.Errorf("本地文件 %s 在上次上传后已被修改，无法继续上传", entry.LocalFile)
+	}
+
+	remotePath, err := u.uploadLargeFile(file, &uploadJob{
+		localFile:   entry.LocalFile,
+		remotePath:  entry.RemotePath,
+		contentType: util.ContentType(entry.LocalFile),
+		hashes:      hashes,
+	})
+	if err != nil {
+		return "", err
+	}
+	return u.buildPublicURL(remotePath), nil
+}
+
+// AbortLargeFile 取消一个未完成的大文件并删除其状态记录。
+// B2 上该文件已不存在 (已完成、已取消或已过期) 时同样删除状态记录
+func (u *Uploader) AbortLargeFile(entry *LargeFileState) error {
+	if err := u.cancelLargeFile(entry.FileID); err != nil {
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !apiErr.FileGone() {
+			return err
+		}
+		fmt.Fprintf(u.Log, "大文件 %s 在 B2 上已不存在，删除本地记录\n", entry.RemotePath)
+	}
+	if u.State != nil {
+		return u.State.Delete(StateKey(entry.LocalFile, entry.ContentMD5))
+	}
+	return nil
+}
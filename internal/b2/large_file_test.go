@@ -0,0 +1,253 @@
+package b2
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeLargeFiles 在 fakeB2 上模拟大文件接口，记录每个 fileId 已上传的分片
+type fakeLargeFiles struct {
+	f *fakeB2
+
+	mu         sync.Mutex
+	parts      map[string]map[int]string // fileId -> 分片号 -> SHA1
+	uploads    map[int]int               // 分片号 -> 上传次数
+	finished   map[string][]string       // fileId -> b2_finish_large_file 提交的 SHA1
+	cancelled  []string
+	failPart   int // 上传该分片时返回错误，0 表示不失败
+	listStatus int // b2_list_parts 返回的错误状态码，0 表示正常返回
+	listCode   string
+}
+
+func newFakeLargeFiles(f *fakeB2) *fakeLargeFiles {
+	l := &fakeLargeFiles{
+		f:        f,
+		parts:    make(map[string]map[int]string),
+		uploads:  make(map[int]int),
+		finished: make(map[string][]string),
+	}
+	f.handle("b2_start_large_file", func(w http.ResponseWriter, r *http.Request) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		fileID := "file-" + strconv.Itoa(f.count("b2_start_large_file"))
+		l.parts[fileID] = make(map[int]string)
+		writeJSON(w, StartLargeFileResponse{FileID: fileID})
+	})
+	f.handle("b2_get_upload_part_url", func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ FileID string }
+		json.NewDecoder(r.Body).Decode(&req)
+		writeJSON(w, UploadPartURLResponse{FileID: req.FileID, UploadURL: f.URL + "/b2_upload_part?fileId=" + req.FileID, UploadAuthorizationToken: "part-token"})
+	})
+	f.handle("b2_upload_part", func(w http.ResponseWriter, r *http.Request) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		partNumber, _ := strconv.Atoi(r.Header.Get("X-Bz-Part-Number"))
+		l.uploads[partNumber]++
+		if partNumber == l.failPart {
+			writeB2Error(w, http.StatusBadRequest, "bad_request", "part rejected", "")
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		sum := sha1.Sum(data)
+		sha := hex.EncodeToString(sum[:])
+		l.parts[r.URL.Query().Get("fileId")][partNumber] = sha
+		writeJSON(w, UploadPartResponse{PartNumber: partNumber, ContentLength: int64(len(data)), ContentSha1: sha})
+	})
+	f.handle("b2_list_parts", func(w http.ResponseWriter, r *http.Request) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		var req struct{ FileID string }
+		json.NewDecoder(r.Body).Decode(&req)
+		if l.listStatus != 0 {
+			writeB2Error(w, l.listStatus, l.listCode, "list parts failed", "")
+			return
+		}
+		var resp ListPartsResponse
+		for partNumber, sha := range l.parts[req.FileID] {
+			resp.Parts = append(resp.Parts, UploadPartResponse{PartNumber: partNumber, ContentSha1: sha})
+		}
+		writeJSON(w, resp)
+	})
+	f.handle("b2_finish_large_file", func(w http.ResponseWriter, r *http.Request) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		var req struct {
+			FileID        string
+			PartSha1Array []string
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		l.finished[req.FileID] = req.PartSha1Array
+		writeJSON(w, UploadFileResponse{FileID: req.FileID})
+	})
+	f.handle("b2_cancel_large_file", func(w http.ResponseWriter, r *http.Request) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		var req struct{ FileID string }
+		json.NewDecoder(r.Body).Decode(&req)
+		l.cancelled = append(l.cancelled, req.FileID)
+		writeJSON(w, map[string]string{"fileId": req.FileID})
+	})
+	return l
+}
+
+// largeFileUploader 返回使用 4 字节分片、单协程上传并保存进度的 Uploader
+func largeFileUploader(t *testing.T, f *fakeB2, statePath string) *Uploader {
+	t.Helper()
+	store, err := OpenStateStore(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := f.authorizedUploader()
+	u.Config.PartSize = 4
+	u.Config.PartConcurrency = 1
+	u.State = store
+	return u
+}
+
+// partSha1s 返回 content 按 4 字节分片的 SHA1
+func partSha1s(content string) []string {
+	var sums []string
+	for i := 0; i < len(content); i += 4 {
+		sum := sha1.Sum([]byte(content[i:min(i+4, len(content))]))
+		sums = append(sums, hex.EncodeToString(sum[:]))
+	}
+	return sums
+}
+
+// uploadLarge 打开 job 对应的本地文件并分片上传
+func uploadLarge(t *testing.T, u *Uploader, job *uploadJob) (string, error) {
+	t.Helper()
+	file, err := os.Open(job.localFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	return u.uploadLargeFile(file, job)
+}
+
+// TestResumeLargeFile 检查分片上传失败后保存进度，重新打开状态文件后只上传缺少的分片
+func TestResumeLargeFile(t *testing.T) {
+	f := newFakeB2(t)
+	l := newFakeLargeFiles(f)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	const content = "0123456789"
+	job := testJob(t, "video.mp4", content)
+
+	l.failPart = 2
+	if _, err := uploadLarge(t, largeFileUploader(t, f, statePath), job); err == nil {
+		t.Fatal("分片 2 上传失败时 uploadLargeFile 没有返回错误")
+	}
+	if len(l.cancelled) != 0 {
+		t.Errorf("保存进度时不应取消大文件，实际取消了 %v", l.cancelled)
+	}
+
+	// 重新打开状态文件，模拟下次运行 b2upload resume
+	u := largeFileUploader(t, f, statePath)
+	entries := u.State.List()
+	if len(entries) != 1 {
+		t.Fatalf("状态文件中有 %d 条记录，期望 1 条", len(entries))
+	}
+	entry := entries[0]
+	if want := map[int]string{1: partSha1s(content)[0]}; entry.FileID != "file-1" || !reflect.DeepEqual(entry.Parts, want) {
+		t.Fatalf("状态记录 fileId = %s，Parts = %v，期望 file-1 和 %v", entry.FileID, entry.Parts, want)
+	}
+
+	l.failPart = 0
+	if _, err := u.ResumeLargeFile(entry); err != nil {
+		t.Fatalf("ResumeLargeFile 出错: %v", err)
+	}
+	if n := f.count("b2_start_large_file"); n != 1 {
+		t.Errorf("b2_start_large_file 调用 %d 次，期望 1 次 (继续使用原来的 fileId)", n)
+	}
+	if want := map[int]int{1: 1, 2: 2, 3: 1}; !reflect.DeepEqual(l.uploads, want) {
+		t.Errorf("各分片上传次数 %v，期望 %v", l.uploads, want)
+	}
+	if got, want := l.finished["file-1"], partSha1s(content); !reflect.DeepEqual(got, want) {
+		t.Errorf("b2_finish_large_file 提交 %v，期望 %v", got, want)
+	}
+	if list := u.State.List(); len(list) != 0 {
+		t.Errorf("上传完成后仍有 %d 条状态记录", len(list))
+	}
+}
+
+// TestResumeLargeFileListPartsError 检查查询分片失败时的处理：临时错误保留进度，fileId 失效时取消旧文件后重新上传
+func TestResumeLargeFileListPartsError(t *testing.T) {
+	f := newFakeB2(t)
+	l := newFakeLargeFiles(f)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	const content = "0123456789"
+	job := testJob(t, "video.mp4", content)
+
+	l.failPart = 3
+	if _, err := uploadLarge(t, largeFileUploader(t, f, statePath), job); err == nil {
+		t.Fatal("分片 3 上传失败时 uploadLargeFile 没有返回错误")
+	}
+	l.failPart = 0
+
+	// 临时错误：不重新上传，也不丢弃进度
+	l.listStatus, l.listCode = http.StatusServiceUnavailable, "service_unavailable"
+	u := largeFileUploader(t, f, statePath)
+	if _, err := uploadLarge(t, u, job); err == nil {
+		t.Fatal("b2_list_parts 返回 503 时 uploadLargeFile 没有返回错误")
+	}
+	if n := f.count("b2_start_large_file"); n != 1 {
+		t.Errorf("b2_start_large_file 调用 %d 次，期望 1 次", n)
+	}
+	if entry := u.State.List(); len(entry) != 1 || entry[0].FileID != "file-1" || len(entry[0].Parts) != 2 {
+		t.Errorf("查询分片的临时错误后状态记录为 %+v，期望保留 file-1 的 2 个分片", entry)
+	}
+
+	// fileId 已失效：取消旧文件，重新创建大文件并上传所有分片
+	l.listStatus, l.listCode = http.StatusBadRequest, "bad_request"
+	u = largeFileUploader(t, f, statePath)
+	if _, err := uploadLarge(t, u, job); err != nil {
+		t.Fatalf("fileId 失效后重新上传出错: %v", err)
+	}
+	if want := []string{"file-1"}; !reflect.DeepEqual(l.cancelled, want) {
+		t.Errorf("取消的大文件 %v，期望 %v", l.cancelled, want)
+	}
+	if got, want := l.finished["file-2"], partSha1s(content); !reflect.DeepEqual(got, want) {
+		t.Errorf("file-2 提交 %v，期望 %v", got, want)
+	}
+	if list := u.State.List(); len(list) != 0 {
+		t.Errorf("上传完成后仍有 %d 条状态记录", len(list))
+	}
+}
+
+// TestAbortLargeFile 检查取消大文件后删除状态记录，B2 上已不存在时同样删除
+func TestAbortLargeFile(t *testing.T) {
+	f := newFakeB2(t)
+	l := newFakeLargeFiles(f)
+	u := largeFileUploader(t, f, filepath.Join(t.TempDir(), "state.json"))
+
+	for _, gone := range []bool{false, true} {
+		entry := &LargeFileState{LocalFile: "/tmp/a.mp4", ContentMD5: "md5", RemotePath: "alice/a.mp4", FileID: "file-1", Parts: map[int]string{}}
+		key := StateKey(entry.LocalFile, entry.ContentMD5)
+		if err := u.State.Put(key, entry); err != nil {
+			t.Fatal(err)
+		}
+		if gone {
+			f.handle("b2_cancel_large_file", func(w http.ResponseWriter, r *http.Request) {
+				writeB2Error(w, http.StatusBadRequest, "file_not_present", "File not present: file-1", "")
+			})
+		}
+		if err := u.AbortLargeFile(entry); err != nil {
+			t.Errorf("gone=%v: AbortLargeFile 出错: %v", gone, err)
+		}
+		if u.State.Get(key) != nil {
+			t.Errorf("gone=%v: 取消后状态记录仍然存在", gone)
+		}
+	}
+	if want := []string{"file-1"}; !reflect.DeepEqual(l.cancelled, want) {
+		t.Errorf("取消的大文件 %v，期望 %v", l.cancelled, want)
+	}
+}
@@ -0,0 +1,215 @@
+package b2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// APIError 是 B2 接口返回的错误，B2 的错误响应体格式为 {"status": 400, "code": "...", "message": "..."}
+type APIError struct {
+	API        string        `json:"-"`       // 出错的接口名称
+	StatusCode int           `json:"status"`  // HTTP 状态码
+	Code       string        `json:"code"`    // B2 错误码，例如 expired_auth_token
+	Message    string        `json:"message"` // B2 返回的错误描述
+	RetryAfter time.Duration `json:"-"`       // Retry-After 响应头要求的等待时间
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("%s 请求失败 (状态码: %d), 响应: %s", e.API, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s 请求失败 (状态码: %d, 错误码: %s): %s", e.API, e.StatusCode, e.Code, e.Message)
+}
+
+// Temporary 判断错误是否为临时错误 (超时、限流、服务端错误)，可以稍后重试
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// ExpiredAuth 判断错误是否由账户授权 Token 过期引起。
+// 上传接口使用的是上传 URL 专属的 Token，过期时只需更换上传 URL，不需要重新授权账户
+func (e *APIError) ExpiredAuth() bool {
+	if e.API == "b2_upload_file" || e.API == "b2_upload_part" {
+		return false
+	}
+	return e.StatusCode == http.StatusUnauthorized && e.Code == "expired_auth_token"
+}
+
+// FileGone 判断错误是否表示文件已不存在：大文件已完成、已取消或已过期时，
+// b2_list_parts 和 b2_cancel_large_file 返回 bad_request 或 file_not_present
+func (e *APIError) FileGone() bool {
+	return e.Code == "bad_request" || e.Code == "file_not_present"
+}
+
+// newAPIError 从非 200 响应中解析 B2 错误信息
+func newAPIError(api string, resp *http.Response) *APIError {
+	body, _ := io.ReadAll(resp.Body)
+	apiErr := &APIError{}
+	if err := json.Unmarshal(body, apiErr); err != nil || apiErr.Code == "" {
+		// 响应体不是 B2 的错误 JSON (例如网关返回的 HTML)，保留原始内容
+		apiErr = &APIError{Message: string(body)}
+	}
+	apiErr.API = api
+	apiErr.StatusCode = resp.StatusCode
+	apiErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	return apiErr
+}
+
+// parseRetryAfter 解析 Retry-After 响应头，支持秒数和 HTTP 日期两种格式
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// permanentError 标记不应再由外层重试的错误 (内层已经重试过)
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// isTemporary 判断 B2 API 调用失败后是否可以原样重试：临时性的 API 错误或网络错误
+func isTemporary(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// needNewUploadURL 判断上传失败后是否需要重新获取上传 URL 并重试。
+// B2 规定遇到 401 (上传 Token 过期)、408、429 和 5xx 响应或网络错误时，应换一个新的上传 URL 再试
+func needNewUploadURL(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusUnauthorized || apiErr.Temporary()
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// backoff 计算第 attempt 次重试前的等待时间：优先遵循 Retry-After，否则使用带随机抖动的指数退避
+func (u *Uploader) backoff(attempt int, err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter
+	}
+	delay := u.Config.RetryBaseDelay << uint(attempt-1)
+	if delay <= 0 || delay > u.Config.RetryMaxDelay {
+		delay = u.Config.RetryMaxDelay
+	}
+	// 在 [delay/2, delay] 范围内随机，避免多个协程同时重试
+	half := int64(delay / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// withRetry 执行 fn，失败时按 retryable 判断是否重试，最多重试 Config.MaxRetries 次。
+// 账户授权 Token 过期时会自动重新授权后立即重试
+func (u *Uploader) withRetry(op string, retryable func(error) bool, fn func() error) error {
+	return u.retry(op, retryable, true, fn)
+}
+
+// retry 是 withRetry 的实现，reauth 为 false 时不处理授权过期 (用于授权请求本身)
+func (u *Uploader) retry(op string, retryable func(error) bool, reauth bool, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		var token string
+		if reauth {
+			token = u.authToken()
+		}
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		var permErr *permanentError
+		if errors.As(err, &permErr) || attempt > u.Config.MaxRetries {
+			return err
+		}
+
+		var apiErr *APIError
+		if reauth && errors.As(err, &apiErr) && apiErr.ExpiredAuth() {
+			fmt.Fprintln(u.Log, "B2 授权已过期，正在重新授权...")
+			if authErr := u.reauthorize(token); authErr != nil {
+				return fmt.Errorf("%w (重新授权失败: %v)", err, authErr)
+			}
+			continue
+		}
+		if !retryable(err) {
+			return err
+		}
+
+		delay := u.backoff(attempt, err)
+		fmt.Fprintf(u.Log, "%s 失败，%.1f 秒后重试 (%d/%d): %v\n", op, delay.Seconds(), attempt, u.Config.MaxRetries, err)
+		time.Sleep(delay)
+	}
+}
+
+// send 发送单个请求，非 200 响应转换为 *APIError。调用方负责关闭返回的响应体
+func (u *Uploader) send(api string, client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s 网络请求失败: %w", api, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, newAPIError(api, resp)
+	}
+	return resp, nil
+}
+
+// apiPost 以 JSON 方式调用 B2 API，并将响应解析到 out 中 (out 可以为 nil)。
+// 临时错误会按配置自动重试，授权过期时自动重新授权
+func (u *Uploader) apiPost(apiName string, body interface{}, out interface{}) error {
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("构造 %s 请求体失败: %w", apiName, err)
+	}
+
+	return u.withRetry("请求 "+apiName, isTemporary, func() error {
+		auth := u.currentAuth()
+		if auth == nil {
+			return &permanentError{fmt.Errorf("尚未授权 B2 账户")}
+		}
+
+		req, err := http.NewRequest("POST", auth.APIURL+"/b2api/v3/"+apiName, bytes.NewReader(requestBody))
+		if err != nil {
+			return &permanentError{fmt.Errorf("创建 %s 请求失败: %w", apiName, err)}
+		}
+		req.Header.Set("Authorization", auth.AuthorizationToken)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := u.send(apiName, u.Client, req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if out == nil {
+			return nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return &permanentError{fmt.Errorf("解析 %s 响应失败: %w", apiName, err)}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,212 @@
+package b2
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xa1st/b2upload/internal/util"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"", 0, 0},
+		{"3", 3 * time.Second, 3 * time.Second},
+		{"0", 0, 0},
+		{"-1", 0, 0},
+		{"soon", 0, 0},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got < tt.min || got > tt.max {
+			t.Errorf("parseRetryAfter(%q) = %s，期望 %s ~ %s", tt.value, got, tt.min, tt.max)
+		}
+	}
+}
+
+// TestRetryTemporaryErrors 检查遇到 429 和 503 时按 Retry-After 等待后重试
+func TestRetryTemporaryErrors(t *testing.T) {
+	f := newFakeB2(t)
+	u := f.authorizedUploader()
+	f.handle("b2_get_upload_url", func(w http.ResponseWriter, r *http.Request) {
+		switch f.count("b2_get_upload_url") {
+		case 1:
+			writeB2Error(w, http.StatusTooManyRequests, "too_many_requests", "slow down", "1")
+		case 2:
+			writeB2Error(w, http.StatusServiceUnavailable, "service_unavailable", "busy", "")
+		default:
+			writeJSON(w, UploadURLResponse{UploadURL: f.URL + "/upload", UploadAuthorizationToken: "upload-token"})
+		}
+	})
+
+	start := time.Now()
+	info, err := u.getUploadURL()
+	if err != nil {
+		t.Fatalf("getUploadURL 出错: %v", err)
+	}
+	if info.UploadAuthorizationToken != "upload-token" {
+		t.Errorf("上传 Token = %q，期望 upload-token", info.UploadAuthorizationToken)
+	}
+	if n := f.count("b2_get_upload_url"); n != 3 {
+		t.Errorf("b2_get_upload_url 调用 %d 次，期望 3 次", n)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("重试前只等待了 %s，没有遵循 Retry-After: 1", elapsed)
+	}
+}
+
+// TestRetryGivesUp 检查超过最大重试次数后返回最后一次的错误
+func TestRetryGivesUp(t *testing.T) {
+	f := newFakeB2(t)
+	u := f.authorizedUploader()
+	f.handle("b2_get_upload_url", func(w http.ResponseWriter, r *http.Request) {
+		writeB2Error(w, http.StatusServiceUnavailable, "service_unavailable", "busy", "")
+	})
+
+	_, err := u.getUploadURL()
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("getUploadURL 返回 %v，期望 503 错误", err)
+	}
+	if n, want := f.count("b2_get_upload_url"), u.Config.MaxRetries+1; n != want {
+		t.Errorf("b2_get_upload_url 调用 %d 次，期望 %d 次", n, want)
+	}
+}
+
+// TestNoRetryOnClientError 检查 400 等非临时错误不重试
+func TestNoRetryOnClientError(t *testing.T) {
+	f := newFakeB2(t)
+	u := f.authorizedUploader()
+	f.handle("b2_get_upload_url", func(w http.ResponseWriter, r *http.Request) {
+		writeB2Error(w, http.StatusBadRequest, "bad_request", "invalid bucketId", "")
+	})
+
+	if _, err := u.getUploadURL(); ErrorCode(err) != "bad_request" {
+		t.Errorf("getUploadURL 返回 %v，期望 bad_request", err)
+	}
+	if n := f.count("b2_get_upload_url"); n != 1 {
+		t.Errorf("b2_get_upload_url 调用 %d 次，期望 1 次", n)
+	}
+}
+
+// TestReauthorizeOnce 检查多个协程同时遇到授权过期时只重新授权一次
+func TestReauthorizeOnce(t *testing.T) {
+	f := newFakeB2(t)
+	u := f.authorizedUploader()
+
+	const workers = 8
+	var arrived sync.WaitGroup
+	arrived.Add(workers)
+	f.handle("b2_get_upload_url", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "auth-1" {
+			// 等所有协程都用旧 Token 发出请求后再返回过期错误
+			arrived.Done()
+			arrived.Wait()
+			writeB2Error(w, http.StatusUnauthorized, "expired_auth_token", "Authorization token has expired", "")
+			return
+		}
+		writeJSON(w, UploadURLResponse{UploadURL: f.URL + "/upload", UploadAuthorizationToken: "upload-token"})
+	})
+
+	var wg sync.WaitGroup
+	errs := make([]error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = u.getUploadURL()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("协程 %d: getUploadURL 出错: %v", i, err)
+		}
+	}
+	if n := f.count("b2_authorize_account"); n != 2 {
+		t.Errorf("b2_authorize_account 调用 %d 次，期望 2 次 (初次授权和一次重新授权)", n)
+	}
+	if token := u.authToken(); token != "auth-2" {
+		t.Errorf("当前 Token = %q，期望 auth-2", token)
+	}
+}
+
+// TestUploadTokenExpiredDoesNotReauthorize 检查上传 Token 过期时只更换上传 URL，不重新授权账户
+func TestUploadTokenExpiredDoesNotReauthorize(t *testing.T) {
+	f := newFakeB2(t)
+	u := f.authorizedUploader()
+	f.handle("b2_get_upload_url", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, UploadURLResponse{UploadURL: f.URL + "/b2_upload_file", UploadAuthorizationToken: "upload-token"})
+	})
+	job := testJob(t, "a.png", "png data")
+	f.handle("b2_upload_file", func(w http.ResponseWriter, r *http.Request) {
+		if f.count("b2_upload_file") == 1 {
+			writeB2Error(w, http.StatusUnauthorized, "expired_auth_token", "upload token expired", "")
+			return
+		}
+		writeJSON(w, UploadFileResponse{FileName: job.remotePath, ContentLength: job.hashes.Size, ContentSha1: job.hashes.SHA1})
+	})
+
+	var uploadInfo *UploadURLResponse
+	if err := u.uploadWithRetry(job, &uploadInfo); err != nil {
+		t.Fatalf("uploadWithRetry 出错: %v", err)
+	}
+	if n := f.count("b2_get_upload_url"); n != 2 {
+		t.Errorf("b2_get_upload_url 调用 %d 次，期望 2 次", n)
+	}
+	if n := f.count("b2_authorize_account"); n != 1 {
+		t.Errorf("b2_authorize_account 调用 %d 次，期望 1 次", n)
+	}
+}
+
+// TestPermanentErrorNotRetried 检查内层已经重试过的错误 (permanentError) 不会再被外层重试
+func TestPermanentErrorNotRetried(t *testing.T) {
+	f := newFakeB2(t)
+	u := f.authorizedUploader()
+	f.handle("b2_get_upload_url", func(w http.ResponseWriter, r *http.Request) {
+		writeB2Error(w, http.StatusServiceUnavailable, "service_unavailable", "busy", "")
+	})
+
+	var uploadInfo *UploadURLResponse
+	err := u.uploadWithRetry(testJob(t, "a.png", "png data"), &uploadInfo)
+	if ErrorCode(err) != "service_unavailable" {
+		t.Fatalf("uploadWithRetry 返回 %v，期望 service_unavailable", err)
+	}
+	// 只有 getUploadURL 内部的重试，外层的 uploadWithRetry 不再重复
+	if n, want := f.count("b2_get_upload_url"), u.Config.MaxRetries+1; n != want {
+		t.Errorf("b2_get_upload_url 调用 %d 次，期望 %d 次", n, want)
+	}
+
+	calls := 0
+	err = u.withRetry("测试", func(error) bool { return true }, func() error {
+		calls++
+		return &permanentError{errors.New("permanent")}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("withRetry 调用 %d 次，返回 %v，期望调用 1 次并返回错误", calls, err)
+	}
+}
+
+// testJob 在临时目录中创建文件并返回对应的上传任务
+func testJob(t *testing.T, name, content string) *uploadJob {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hashes, err := util.HashFile(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &uploadJob{localFile: path, remotePath: "alice/" + name, contentType: util.ContentType(path), hashes: hashes}
+}
@@ -0,0 +1,143 @@
+package b2
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xa1st/b2upload/internal/util"
+)
+
+// LargeFileState 记录一个未完成大文件的上传进度，用于进程中断后继续上传
+type LargeFileState struct {
+	Tag         string         `json:"tag"`         // 上传时使用的配置标签
+	LocalFile   string         `json:"localFile"`   // 本地文件的绝对路径
+	ContentMD5  string         `json:"contentMd5"`  // 本地文件内容的 MD5
+	ContentSha1 string         `json:"contentSha1"` // 本地文件内容的 SHA1 (保存为 large_file_sha1)
+	Size        int64          `json:"size"`        // 本地文件大小
+	Bucket      string         `json:"bucket"`      // 目标 Bucket 名称
+	RemotePath  string         `json:"remotePath"`  // B2 中的文件名
+	FileID      string         `json:"fileId"`      // b2_start_large_file 返回的 fileId
+	PartSize    int64          `json:"partSize"`    // 分片大小
+	Parts       map[int]string `json:"parts"`       // 已完成的分片: 分片号 -> SHA1
+	UpdatedAt   time.Time      `json:"updatedAt"`
+}
+
+// StateStore 是保存在本地 JSON 文件中的大文件上传进度记录，可被多个协程安全使用
+type StateStore struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]*LargeFileState
+}
+
+// StateKey 根据本地文件路径和内容 MD5 生成状态记录的键
+func StateKey(localFile, contentMD5 string) string {
+	return localFile + "|" + contentMD5
+}
+
+// OpenStateStore 打开 (或新建) 指定路径的状态文件
+func OpenStateStore(path string) (*StateStore, error) {
+	store := &StateStore{path: path, entries: make(map[string]*LargeFileState)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, fmt.Errorf("读取上传状态文件失败: %w", err)
+	}
+	if len(data) == 0 {
+		return store, nil
+	}
+	if err := json.Unmarshal(data, &store.entries); err != nil {
+		return nil, fmt.Errorf("解析上传状态文件 %s 失败: %w", path, err)
+	}
+	return store, nil
+}
+
+// Path 返回状态文件路径
+func (s *StateStore) Path() string {
+	return s.path
+}
+
+// Get 返回指定键的状态记录副本，不存在时返回 nil
+func (s *StateStore) Get(key string) *LargeFileState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	return entry.clone()
+}
+
+// List 返回所有状态记录的副本，按更新时间排序
+func (s *StateStore) List() []*LargeFileState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*LargeFileState, 0, len(s.entries))
+	for _, entry := range s.entries {
+		list = append(list, entry.clone())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].UpdatedAt.Before(list[j].UpdatedAt) })
+	return list
+}
+
+// Put 保存 (覆盖) 一条状态记录并写入磁盘
+func (s *StateStore) Put(key string, entry *LargeFileState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry = entry.clone()
+	entry.UpdatedAt = time.Now()
+	s.entries[key] = entry
+	return s.save()
+}
+
+// RecordPart 记录一个已完成的分片并写入磁盘
+func (s *StateStore) RecordPart(key string, partNumber int, partSha1 string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return fmt.Errorf("上传状态记录不存在: %s", key)
+	}
+	entry.Parts[partNumber] = partSha1
+	entry.UpdatedAt = time.Now()
+	return s.save()
+}
+
+// Delete 删除一条状态记录并写入磁盘
+func (s *StateStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[key]; !ok {
+		return nil
+	}
+	delete(s.entries, key)
+	return s.save()
+}
+
+// save 将所有记录写入临时文件后再重命名，避免进程中断时留下损坏的状态文件 (调用方需持有锁)
+func (s *StateStore) save() error {
+	data, err := json.MarshalIndent(s.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化上传状态失败: %w", err)
+	}
+	if err := util.WriteFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("写入上传状态文件失败: %w", err)
+	}
+	return nil
+}
+
+// clone 复制一条状态记录，避免调用方修改存储中的数据
+func (e *LargeFileState) clone() *LargeFileState {
+	c := *e
+	c.Parts = make(map[int]string, len(e.Parts))
+	for k, v := range e.Parts {
+		c.Parts[k] = v
+	}
+	return &c
+}
@@ -0,0 +1,93 @@
+package b2
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestStateStoreRoundTrip 检查状态记录写入磁盘后重新打开仍然一致
+func TestStateStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := OpenStateStore(path)
+	if err != nil {
+		t.Fatalf("打开不存在的状态文件出错: %v", err)
+	}
+	if list := store.List(); len(list) != 0 {
+		t.Fatalf("新的状态文件包含 %d 条记录", len(list))
+	}
+
+	key := StateKey("/tmp/a.mp4", "md5")
+	entry := &LargeFileState{
+		Tag: "custom", LocalFile: "/tmp/a.mp4", ContentMD5: "md5", ContentSha1: "sha1", Size: 10,
+		Bucket: "pics", RemotePath: "alice/a.mp4", FileID: "file-1", PartSize: 4, Parts: map[int]string{},
+	}
+	if err := store.Put(key, entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RecordPart(key, 1, "part-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RecordPart(key, 3, "part-3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RecordPart("missing", 1, "x"); err == nil {
+		t.Error("RecordPart 不存在的记录时没有返回错误")
+	}
+
+	// Get 返回副本，修改副本不影响存储的记录
+	got := store.Get(key)
+	got.Parts[2] = "changed"
+	if _, ok := store.Get(key).Parts[2]; ok {
+		t.Error("修改 Get 返回的记录影响了存储中的数据")
+	}
+
+	reopened, err := OpenStateStore(path)
+	if err != nil {
+		t.Fatalf("重新打开状态文件出错: %v", err)
+	}
+	saved := reopened.Get(key)
+	if saved == nil {
+		t.Fatal("重新打开后找不到状态记录")
+	}
+	if want := map[int]string{1: "part-1", 3: "part-3"}; !reflect.DeepEqual(saved.Parts, want) {
+		t.Errorf("Parts = %v，期望 %v", saved.Parts, want)
+	}
+	if saved.FileID != "file-1" || saved.RemotePath != "alice/a.mp4" || saved.Size != 10 || saved.UpdatedAt.IsZero() {
+		t.Errorf("重新打开后的记录不一致: %+v", saved)
+	}
+
+	if err := reopened.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Delete(key); err != nil {
+		t.Errorf("重复删除出错: %v", err)
+	}
+	reopened, err = OpenStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Get(key) != nil {
+		t.Error("删除后重新打开仍能找到状态记录")
+	}
+}
+
+func TestOpenStateStoreErrors(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.json")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenStateStore(empty); err != nil {
+		t.Errorf("打开空的状态文件出错: %v", err)
+	}
+
+	broken := filepath.Join(dir, "broken.json")
+	if err := os.WriteFile(broken, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenStateStore(broken); err == nil {
+		t.Error("打开损坏的状态文件没有返回错误")
+	}
+}
@@ -1,15 +1,16 @@
 package b2
 
 import (
-	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -20,12 +21,28 @@ import (
 
 // --- B2 API 响应结构体 ---
 
+// AllowedBucket 是密钥可以访问的 Bucket
+type AllowedBucket struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// AllowedInfo 是 b2_authorize_account 响应中的 "allowed" 字段，描述密钥的权限和访问范围
+type AllowedInfo struct {
+	Capabilities []string        `json:"capabilities"`
+	Buckets      []AllowedBucket `json:"buckets"`    // v3 结构：密钥限定的 Bucket，为空表示不限
+	BucketID     string          `json:"bucketId"`   // v2 结构
+	BucketName   string          `json:"bucketName"` // v2 结构
+	NamePrefix   string          `json:"namePrefix"` // 只能访问以该前缀开头的文件，为空表示不限
+}
+
 // StorageAPIInfo 用于捕获 JSON 中 "storageApi" 的核心信息
 type StorageAPIInfo struct {
-	APIURL      string `json:"apiUrl"`
-	DownloadURL string `json:"downloadUrl"`
-	BucketID    string `json:"bucketId"`   // 捕获 Bucket ID
-	BucketName  string `json:"bucketName"` // 捕获 Bucket Name
+	APIURL      string      `json:"apiUrl"`
+	DownloadURL string      `json:"downloadUrl"`
+	BucketID    string      `json:"bucketId"`   // 捕获 Bucket ID
+	BucketName  string      `json:"bucketName"` // 捕获 Bucket Name
+	Allowed     AllowedInfo `json:"allowed"`
 }
 
 // APIInfo 捕获 b2_authorize_account 响应中的 API 信息组
@@ -46,7 +63,8 @@ type AuthResponse struct {
 	APIURL      string `json:"apiUrl"`
 	DownloadURL string `json:"downloadUrl"`
 
-	AccountID string `json:"accountId"`
+	AccountID string      `json:"accountId"`
+	Allowed   AllowedInfo `json:"allowed"` // v2 结构中位于根部
 
 	// NEW: 存储最终提取的 Bucket ID
 	BucketIDToUse string // Populated by AuthorizeAccount
@@ -58,9 +76,16 @@ type UploadURLResponse struct {
 	UploadAuthorizationToken string `json:"authorizationToken"` // 文件上传专用的 Token
 }
 
-// UploadFileResponse b2_upload_file 的响应
+// UploadFileResponse b2_upload_file 的响应，也是 b2_list_file_names / b2_list_file_versions 返回的文件信息
 type UploadFileResponse struct {
-	FileName string `json:"fileName"`
+	FileID          string            `json:"fileId"`
+	FileName        string            `json:"fileName"`
+	Action          string            `json:"action"` // upload、hide、start (未完成的大文件) 或 folder
+	ContentLength   int64             `json:"contentLength"`
+	ContentType     string            `json:"contentType"`
+	ContentSha1     string            `json:"contentSha1"` // 大文件为 "none"
+	FileInfo        map[string]string `json:"fileInfo"`    // 上传时保存的自定义信息，例如 large_file_sha1
+	UploadTimestamp int64             `json:"uploadTimestamp"`
 }
 
 // ListFileNamesResponse b2_list_file_names 的响应
@@ -71,60 +96,148 @@ type ListFileNamesResponse struct {
 
 // UploadResult 存储单个文件上传的结果
 type UploadResult struct {
-	LocalFile string
-	PublicURL string
-	Error     error
-	Skipped   bool // 新增字段，标记是否因已存在而跳过
+	LocalFile   string
+	RemotePath  string // B2 中的文件名，生成远程路径失败时为空
+	PublicURL   string
+	Size        int64
+	ContentType string
+	MD5         string
+	SHA1        string
+	Error       error
+	Skipped     bool          // 新增字段，标记是否因已存在而跳过
+	Duration    time.Duration // 检查和上传该文件所用的时间 (不含计算哈希)
+}
+
+// ErrChecksumMismatch 表示 B2 保存的内容与本地文件的校验值不一致
+var ErrChecksumMismatch = errors.New("B2 返回的校验值与本地文件不一致")
+
+// ErrorCode 返回便于脚本判断的错误码：B2 接口错误使用 B2 返回的错误码 (如 expired_auth_token)，
+// 其他错误按类型归类为 checksum_mismatch、network_error、local_error 等
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.Code != "" {
+			return apiErr.Code
+		}
+		return fmt.Sprintf("http_%d", apiErr.StatusCode)
+	}
+	if errors.Is(err, ErrChecksumMismatch) {
+		return "checksum_mismatch"
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return "network_error"
+	}
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return "local_error"
+	}
+	return "error"
 }
 
 // Uploader 包含 B2 上传所需的配置和授权信息
 type Uploader struct {
-	Config   *config.Config
-	Auth     *AuthResponse
-	Client   *http.Client
-	UploadMu sync.Mutex // 保护上传 URL 资源的互斥锁
+	Config *config.Config
+	Auth   *AuthResponse
+	Client *http.Client
+	// UploadClient 用于发送文件数据，不设置总超时，避免大文件在慢速网络下被强行中断
+	UploadClient *http.Client
+	// State 记录未完成大文件的上传进度，为 nil 时不支持断点续传
+	State *StateStore
+	// Log 接收上传过程中的提示信息，默认为标准输出
+	Log io.Writer
+	// Overwrite 为 true 时不检查远程是否已存在同名文件，直接上传新版本 (sync 用于更新已修改的文件)
+	Overwrite bool
+
+	authMu sync.RWMutex // 保护 Auth，授权过期时多个协程可能同时触发重新授权
 }
 
-const (
-	authorizeURL     = "https://api.backblazeb2.com/b2api/v3/b2_authorize_account"
-	concurrencyLimit = 5
-)
+const concurrencyLimit = 5
 
 // NewUploader 创建一个新的 Uploader 实例
 func NewUploader(cfg *config.Config) *Uploader {
 	return &Uploader{
 		Config: cfg,
+		Log:    os.Stdout,
 		Client: &http.Client{Timeout: 60 * time.Second}, // 延长超时时间以适应大文件
+		UploadClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				ResponseHeaderTimeout: 5 * time.Minute, // 数据发送完毕后等待 B2 响应的最长时间
+			},
+		},
 	}
 }
 
-// AuthorizeAccount 执行 B2 授权流程 (保持不变)
+// AuthorizeAccount 执行 B2 授权流程
 func (u *Uploader) AuthorizeAccount() error {
-	fmt.Println("正在进行 B2 授权...")
+	u.authMu.Lock()
+	defer u.authMu.Unlock()
+	return u.authorize()
+}
+
+// currentAuth 返回当前的授权信息，可被多个协程安全调用
+func (u *Uploader) currentAuth() *AuthResponse {
+	u.authMu.RLock()
+	defer u.authMu.RUnlock()
+	return u.Auth
+}
+
+// authToken 返回当前的账户授权 Token，尚未授权时返回空字符串
+func (u *Uploader) authToken() string {
+	if auth := u.currentAuth(); auth != nil {
+		return auth.AuthorizationToken
+	}
+	return ""
+}
+
+// reauthorize 在授权 Token 过期后重新授权。
+// 如果其他协程已经用新的 Token 替换了 failedToken，则直接返回
+func (u *Uploader) reauthorize(failedToken string) error {
+	u.authMu.Lock()
+	defer u.authMu.Unlock()
+	if u.Auth != nil && u.Auth.AuthorizationToken != failedToken {
+		return nil
+	}
+	return u.authorize()
+}
+
+// authorize 调用 b2_authorize_account 并解析授权信息 (调用方需持有 authMu 写锁)
+func (u *Uploader) authorize() error {
+	fmt.Fprintln(u.Log, "正在进行 B2 授权...")
 	// B2 认证需要 Basic Auth，将 keyId:key 进行 Base64 编码
 	authString := base64.StdEncoding.EncodeToString([]byte(u.Config.Token))
 
-	req, err := http.NewRequest("GET", authorizeURL, nil)
-	if err != nil {
-		return fmt.Errorf("创建授权请求失败: %w", err)
-	}
+	var bodyBytes []byte
+	// 授权请求本身不处理授权过期，且调用方已持有 authMu，不能再读取当前 Token
+	err := u.retry("B2 授权", isTemporary, false, func() error {
+		req, err := http.NewRequest("GET", u.Config.APIURL+"/b2api/v3/b2_authorize_account", nil)
+		if err != nil {
+			return &permanentError{fmt.Errorf("创建授权请求失败: %w", err)}
+		}
+		req.Header.Add("Authorization", "Basic "+authString)
 
-	req.Header.Add("Authorization", "Basic "+authString)
+		resp, err := u.send("b2_authorize_account", u.Client, req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
 
-	resp, err := u.Client.Do(req)
+		// 读取完整的 Body
+		bodyBytes, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("读取 B2 授权响应失败: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("B2 授权网络请求失败: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("B2 授权失败 (状态码: %d), 响应: %s", resp.StatusCode, string(body))
+		return err
 	}
 
 	var auth AuthResponse
-	// 读取完整的 Body
-	bodyBytes, _ := io.ReadAll(resp.Body)
 	if err := json.Unmarshal(bodyBytes, &auth); err != nil {
 		return fmt.Errorf("解析 B2 授权响应失败: %w", err)
 	}
@@ -153,6 +266,14 @@ func (u *Uploader) AuthorizeAccount() error {
 	if auth.BucketIDToUse == "" && auth.APIInfo.B2.BucketID != "" {
 		auth.BucketIDToUse = auth.APIInfo.B2.BucketID
 	}
+	// v3 结构：从密钥限定的 Bucket 列表中查找配置的 Bucket
+	if auth.BucketIDToUse == "" {
+		for _, bucket := range auth.Permissions().Buckets {
+			if bucket.Name == u.Config.Bucket {
+				auth.BucketIDToUse = bucket.ID
+			}
+		}
+	}
 	// ********************************************
 
 	if auth.APIURL == "" {
@@ -165,56 +286,51 @@ func (u *Uploader) AuthorizeAccount() error {
 
 	u.Auth = &auth
 
-	fmt.Println("B2 API URL 解析成功")
-	fmt.Println("B2 Bucket ID 解析成功")
+	fmt.Fprintln(u.Log, "B2 API URL 解析成功")
+	fmt.Fprintln(u.Log, "B2 Bucket ID 解析成功")
 	return nil
 }
 
-// getUploadURL 获取文件上传专用的 URL 和 Token (保持不变)
+// Permissions 返回密钥的权限和访问范围，兼容 v3 (apiInfo.storageApi.allowed) 和 v2 (根部 allowed) 结构。
+// v2 结构中限定的单个 Bucket 也会放入 Buckets
+func (a *AuthResponse) Permissions() AllowedInfo {
+	allowed := a.Allowed
+	for _, candidate := range []AllowedInfo{a.APIInfo.StorageAPI.Allowed, a.APIInfo.B2.Allowed} {
+		if len(candidate.Capabilities) > 0 {
+			allowed = candidate
+			break
+		}
+	}
+	if len(allowed.Buckets) == 0 && allowed.BucketID != "" {
+		allowed.Buckets = []AllowedBucket{{ID: allowed.BucketID, Name: allowed.BucketName}}
+	}
+	return allowed
+}
+
+// getUploadURL 获取文件上传专用的 URL 和 Token
 func (u *Uploader) getUploadURL() (*UploadURLResponse, error) {
-	if u.Auth == nil {
+	auth := u.currentAuth()
+	if auth == nil {
 		return nil, fmt.Errorf("尚未授权 B2 账户")
 	}
 
-	bucketID := u.Auth.BucketIDToUse
+	bucketID := auth.BucketIDToUse
 	if bucketID == "" {
 		return nil, fmt.Errorf("Bucket ID 缺失，无法获取上传 URL。请重新授权。")
 	}
 
-	// 构造 b2_get_upload_url 请求体
-	requestBody, _ := json.Marshal(map[string]string{
-		"bucketId": bucketID,
-	})
-
-	// 使用解析成功的 APIURL
-	url := u.Auth.APIURL + "/b2api/v3/b2_get_upload_url"
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
-	if err != nil {
-		return nil, fmt.Errorf("创建获取上传URL请求失败: %w", err)
-	}
-
-	req.Header.Set("Authorization", u.Auth.AuthorizationToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := u.Client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("获取上传URL网络请求失败: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("获取上传URL失败 (状态码: %d), 响应: %s", resp.StatusCode, string(body))
-	}
-
 	var uploadResp UploadURLResponse
-	if err := json.NewDecoder(resp.Body).Decode(&uploadResp); err != nil {
-		return nil, fmt.Errorf("解析上传URL响应失败: %w", err)
+	if err := u.apiPost("b2_get_upload_url", map[string]string{"bucketId": bucketID}, &uploadResp); err != nil {
+		return nil, err
 	}
-
 	return &uploadResp, nil
 }
 
+// PublicURL 返回 B2 中指定文件的公开 URL
+func (u *Uploader) PublicURL(remotePath string) string {
+	return u.buildPublicURL(remotePath)
+}
+
 // buildPublicURL 构造最终的公开 URL
 func (u *Uploader) buildPublicURL(remotePath string) string {
 	if u.Config.URL != "" {
@@ -228,202 +344,318 @@ func (u *Uploader) buildPublicURL(remotePath string) string {
 		if !strings.HasSuffix(finalURL, "/") {
 			finalURL += "/"
 		}
-		return finalURL + cleanRemotePath
+		return finalURL + encodeFileName(cleanRemotePath)
 	}
 
 	// 使用 B2 官方下载域名 (Auth.DownloadURL)
-	return fmt.Sprintf("%s/file/%s/%s", u.Auth.DownloadURL, u.Config.Bucket, remotePath)
+	return fmt.Sprintf("%s/file/%s/%s", u.currentAuth().DownloadURL, u.Config.Bucket, encodeFileName(remotePath))
+}
+
+// encodeFileName 按 B2 的要求对文件名进行百分号编码 (保留 /)，
+// 用于 X-Bz-File-Name 请求头和公开 URL，文件名中可能包含空格、中文等字符
+func encodeFileName(name string) string {
+	segments := strings.Split(name, "/")
+	for i, seg := range segments {
+		// PathEscape 不会编码 +，而 B2 会把 + 解码为空格
+		segments[i] = strings.ReplaceAll(url.PathEscape(seg), "+", "%2B")
+	}
+	return strings.Join(segments, "/")
 }
 
-// checkFileExists 检查文件是否已存在于 B2 存储桶中
-func (u *Uploader) checkFileExists(remotePath string) (string, bool, error) {
-	if u.Auth == nil || u.Auth.BucketIDToUse == "" {
-		return "", false, fmt.Errorf("授权信息不完整，无法检查文件存在性")
+// checkFileExists 查询 B2 存储桶中的同名文件，不存在时返回 nil
+func (u *Uploader) checkFileExists(remotePath string) (*UploadFileResponse, error) {
+	auth := u.currentAuth()
+	if auth == nil || auth.BucketIDToUse == "" {
+		return nil, fmt.Errorf("授权信息不完整，无法检查文件存在性")
 	}
 
 	// 构造 b2_list_file_names 请求体：只请求一个文件
-	requestBody, _ := json.Marshal(map[string]interface{}{
-		"bucketId":      u.Auth.BucketIDToUse,
+	var listResp ListFileNamesResponse
+	err := u.apiPost("b2_list_file_names", map[string]interface{}{
+		"bucketId":      auth.BucketIDToUse,
 		"startFileName": remotePath, // 从该文件名开始查找
 		"maxFileCount":  1,          // 只查找一个
-	})
-
-	url := u.Auth.APIURL + "/b2api/v3/b2_list_file_names"
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
+	}, &listResp)
 	if err != nil {
-		return "", false, fmt.Errorf("创建文件列表请求失败: %w", err)
+		return nil, err
 	}
 
-	req.Header.Set("Authorization", u.Auth.AuthorizationToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := u.Client.Do(req)
-	if err != nil {
-		return "", false, fmt.Errorf("文件列表网络请求失败: %w", err)
+	// 检查返回的文件列表：如果文件列表不为空，且第一个文件的名字就是我们要找的，则文件存在。
+	if len(listResp.Files) > 0 && listResp.Files[0].FileName == remotePath {
+		return &listResp.Files[0], nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", false, fmt.Errorf("文件列表请求失败 (状态码: %d), 响应: %s", resp.StatusCode, string(body))
-	}
+	return nil, nil
+}
 
-	var listResp ListFileNamesResponse
-	if err := json.NewDecoder(resp.Body).Decode(&listResp); err != nil {
-		return "", false, fmt.Errorf("解析文件列表响应失败: %w", err)
-	}
+const (
+	// FileInfoOriginalName 是保存原始文件名的 B2 文件信息键，下载时用于还原文件名
+	FileInfoOriginalName = "original_name"
+	// FileInfoLastModified 是保存本地文件修改时间 (Unix 毫秒) 的 B2 文件信息键，与 B2 官方工具一致
+	FileInfoLastModified = "src_last_modified_millis"
+)
 
-	// 检查返回的文件列表：如果文件列表不为空，且第一个文件的名字就是我们要找的，则文件存在。
-	if len(listResp.Files) > 0 && listResp.Files[0].FileName == remotePath {
-		publicURL := u.buildPublicURL(remotePath)
-		return publicURL, true, nil
+// fileInfo 返回上传时保存到 B2 的自定义文件信息。X-Bz-Info-* 请求头的值需要百分号编码，
+// 为了让普通上传和大文件上传保存相同的值，原始文件名在这里统一编码
+func fileInfo(localFile string) map[string]string {
+	info := map[string]string{FileInfoOriginalName: encodeFileName(filepath.Base(localFile))}
+	if stat, err := os.Stat(localFile); err == nil {
+		info[FileInfoLastModified] = strconv.FormatInt(stat.ModTime().UnixMilli(), 10)
 	}
+	return info
+}
 
-	return "", false, nil
+// uploadJob 描述一个待上传的文件。文件只在准备阶段读取一次，得到的哈希同时用于命名和上传校验
+type uploadJob struct {
+	localFile   string
+	remotePath  string
+	contentType string
+	hashes      *util.FileHashes
 }
 
-// uploadSingleFile 执行单个文件的 B2 上传操作
-func (u *Uploader) uploadSingleFile(localFilePath, remotePath string, uploadInfo *UploadURLResponse) (string, error) {
-	// *** 1. 检查文件是否存在 ***
-	publicURL, exists, err := u.checkFileExists(remotePath)
+// prepareJob 读取一次本地文件计算哈希，并按路径模板生成远程路径
+func (u *Uploader) prepareJob(localFile, relPath string) (*uploadJob, error) {
+	hashes, err := util.HashFile(localFile, u.Config.PathTemplate.NeedsSHA256())
 	if err != nil {
-		// 如果检查失败，我们选择继续尝试上传，但记录警告
-		fmt.Printf("警告：检查文件存在性失败 (%s)，将尝试上传: %v\n", remotePath, err)
+		return nil, err
+	}
+	remotePath := u.Config.PathTemplate.Render(util.PathVars{
+		User:      u.Config.User,
+		Tag:       u.Config.Tag,
+		LocalFile: localFile,
+		RelPath:   relPath,
+		Time:      time.Now(),
+		Hashes:    hashes,
+	})
+	if remotePath == "" {
+		return nil, fmt.Errorf("路径模板 %s 生成的远程路径为空", u.Config.PathTemplate)
+	}
+	return &uploadJob{
+		localFile:   localFile,
+		remotePath:  remotePath,
+		contentType: util.ContentType(localFile),
+		hashes:      hashes,
+	}, nil
+}
+
+// uploadFile 上传单个文件：先检查一次是否已存在，存在且大小和 SHA1 一致时直接返回并标记为跳过，
+// 否则按文件大小选择普通上传或大文件分片上传 (同名文件内容不同时上传为新版本)。返回 B2 中实际的文件名
+func (u *Uploader) uploadFile(job *uploadJob, existing *existingFiles, uploadInfo **UploadURLResponse) (remotePath string, skipped bool, err error) {
+	// 1. 检查文件是否存在：优先使用批量列出的结果，前缀未能列出时才单独检查 (每个文件只检查一次)
+	remote, known := existing.lookup(job.remotePath)
+	if !known && !u.Overwrite {
+		remote, err = u.checkFileExists(job.remotePath)
+		if err != nil {
+			// 如果检查失败，我们选择继续尝试上传，但记录警告
+			fmt.Fprintf(u.Log, "警告：检查文件存在性失败 (%s)，将尝试上传: %v\n", job.remotePath, err)
+		}
 	}
-	if exists {
-		return publicURL, nil // 文件已存在，直接返回 URL，跳过后续上传流程
+	if remote != nil {
+		if sameContent(remote, job) {
+			return job.remotePath, true, nil // 相同内容已存在，跳过后续上传流程
+		}
+		// 路径模板不含内容哈希时，同名文件可能是旧内容
+		fmt.Fprintf(u.Log, "远程文件 %s 的内容与本地不同，上传为新版本\n", job.remotePath)
 	}
 
-	// 2. 准备文件数据和元数据
-	file, err := os.Open(localFilePath)
-	if err != nil {
-		return "", fmt.Errorf("无法打开本地文件 %s: %w", localFilePath, err)
+	// 2. 超过阈值的文件改用大文件分片接口上传 (支持断点续传，实际远程路径可能沿用上次的记录)
+	if job.hashes.Size > u.Config.LargeFileThreshold {
+		file, err := os.Open(job.localFile)
+		if err != nil {
+			return "", false, fmt.Errorf("无法打开本地文件 %s: %w", job.localFile, err)
+		}
+		defer file.Close()
+
+		remotePath, err := u.uploadLargeFile(file, job)
+		if err != nil {
+			return "", false, err
+		}
+		return remotePath, false, nil
 	}
-	defer file.Close()
 
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return "", fmt.Errorf("无法获取文件信息: %w", err)
+	// 3. 普通上传 (上传 URL 失效时自动更换并重试)
+	if err := u.uploadWithRetry(job, uploadInfo); err != nil {
+		return "", false, err
 	}
-	// 计算 MD5
-	fileMD5, err := util.CalculateFileMD5(localFilePath)
+	return job.remotePath, false, nil
+}
+
+// uploadSingleFile 使用 b2_upload_file 上传单个文件，并核对 B2 保存的内容
+func (u *Uploader) uploadSingleFile(job *uploadJob, uploadInfo *UploadURLResponse) error {
+	// 1. 打开文件，数据直接从文件流式发送
+	file, err := os.Open(job.localFile)
 	if err != nil {
-		return "", err
-	}
-	// 猜测 Content Type
-	contentType := mime.TypeByExtension(strings.ToLower(filepath.Ext(localFilePath)))
-	if contentType == "" {
-		contentType = "application/octet-stream"
+		return fmt.Errorf("无法打开本地文件 %s: %w", job.localFile, err)
 	}
+	defer file.Close()
 
-	// 3. 构造 b2_upload_file 请求
+	// 2. 构造 b2_upload_file 请求
 	req, err := http.NewRequest("POST", uploadInfo.UploadURL, file)
 	if err != nil {
-		return "", fmt.Errorf("创建上传请求失败: %w", err)
+		return fmt.Errorf("创建上传请求失败: %w", err)
 	}
 
 	// 必须的请求头
 	req.Header.Set("Authorization", uploadInfo.UploadAuthorizationToken)
-	req.Header.Set("X-Bz-File-Name", remotePath)
-	req.Header.Set("Content-Type", contentType)
-	req.ContentLength = fileInfo.Size()
+	req.Header.Set("X-Bz-File-Name", encodeFileName(job.remotePath))
+	req.Header.Set("Content-Type", job.contentType)
+	req.ContentLength = job.hashes.Size
 
 	// 校验头: 使用 Content-MD5 (B2 兼容)
-	req.Header.Set("X-Bz-Content-Md5", fileMD5)
-	// B2 官方推荐 X-Bz-Content-Sha1，这里使用 "do_not_verify" 以避免计算 SHA-1
-	req.Header.Set("X-Bz-Content-Sha1", "do_not_verify")
+	req.Header.Set("X-Bz-Content-Md5", job.hashes.MD5)
+	// B2 会用 SHA1 校验收到的数据，不一致时拒绝保存
+	req.Header.Set("X-Bz-Content-Sha1", job.hashes.SHA1)
+	// 自定义文件信息 (原始文件名等)，fileInfo 返回的值已经过百分号编码
+	for k, v := range fileInfo(job.localFile) {
+		req.Header.Set("X-Bz-Info-"+k, v)
+	}
 
-	// 4. 执行上传
-	resp, err := u.Client.Do(req)
+	// 3. 执行上传，非 200 响应会被解析为 *APIError
+	resp, err := u.send("b2_upload_file", u.UploadClient, req)
 	if err != nil {
-		return "", fmt.Errorf("B2 上传网络请求失败: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
-	// 5. 处理响应
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("B2 上传失败 (状态码: %d), 响应: %s", resp.StatusCode, string(body))
+	// 4. 再次核对 B2 实际保存的内容，防止内容被截断
+	var uploadResp UploadFileResponse
+	if err := json.NewDecoder(resp.Body).Decode(&uploadResp); err != nil {
+		return fmt.Errorf("解析上传响应失败: %w", err)
+	}
+	if uploadResp.ContentSha1 != job.hashes.SHA1 || uploadResp.ContentLength != job.hashes.Size {
+		return fmt.Errorf("%w: 本地 SHA1 %s (%d 字节)，B2 保存的 SHA1 %s (%d 字节)",
+			ErrChecksumMismatch, job.hashes.SHA1, job.hashes.Size, uploadResp.ContentSha1, uploadResp.ContentLength)
+	}
+	return nil
+}
+
+// uploadWithRetry 使用工作协程自己的上传 URL 上传单个文件。
+// 上传 URL 失效或遇到可重试的错误时，丢弃旧 URL、按指数退避等待后重新获取 URL 再次上传
+func (u *Uploader) uploadWithRetry(job *uploadJob, uploadInfo **UploadURLResponse) error {
+	return u.withRetry("上传 "+filepath.Base(job.localFile), needNewUploadURL, func() error {
+		if *uploadInfo == nil {
+			info, err := u.getUploadURL()
+			if err != nil {
+				// getUploadURL 内部已经重试过，这里不再重复重试
+				return &permanentError{fmt.Errorf("无法上传，B2 上传 URL 获取失败: %w", err)}
+			}
+			*uploadInfo = info
+		}
+
+		err := u.uploadSingleFile(job, *uploadInfo)
+		if err != nil && needNewUploadURL(err) {
+			*uploadInfo = nil
+		}
+		return err
+	})
+}
+
+// prepareJobs 并发读取所有文件计算哈希并生成远程路径，返回值与 filesToUpload 一一对应
+func (u *Uploader) prepareJobs(filesToUpload []util.SourceFile) ([]*uploadJob, []error) {
+	jobs := make([]*uploadJob, len(filesToUpload))
+	errs := make([]error, len(filesToUpload))
+	indexes := make(chan int, len(filesToUpload))
+	for i := range filesToUpload {
+		indexes <- i
+	}
+	close(indexes)
+
+	numWorkers := concurrencyLimit
+	if len(filesToUpload) < concurrencyLimit {
+		numWorkers = len(filesToUpload)
 	}
 
-	// 6. 构造最终的公开 URL
-	return u.buildPublicURL(remotePath), nil
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				file := filesToUpload[idx]
+				jobs[idx], errs[idx] = u.prepareJob(filepath.Clean(file.Path), file.Rel)
+			}
+		}()
+	}
+	wg.Wait()
+	return jobs, errs
 }
 
-// UploadFiles 并发上传文件列表
-func (u *Uploader) UploadFiles(filesToUpload []string) []UploadResult {
-	results := make(chan UploadResult, len(filesToUpload))
-	paths := make(chan string, len(filesToUpload))
+// UploadFiles 并发上传文件列表，返回的结果与 filesToUpload 的顺序一致
+func (u *Uploader) UploadFiles(filesToUpload []util.SourceFile) []UploadResult {
+	results := make([]UploadResult, len(filesToUpload))
+	pending := make(chan int, len(filesToUpload))
 	var wg sync.WaitGroup
 
-	// 在主协程中获取上传 URL
-	uploadInfo, err := u.getUploadURL()
+	// 1. 读取一次文件计算哈希，并生成远程路径
+	jobs, errs := u.prepareJobs(filesToUpload)
+	var ready []*uploadJob
+	for i, job := range jobs {
+		if errs[i] != nil {
+			results[i] = UploadResult{LocalFile: filepath.Clean(filesToUpload[i].Path), Error: fmt.Errorf("无法生成远程路径: %w", errs[i])}
+			continue
+		}
+		ready = append(ready, job)
+	}
+
+	// 2. 按目录前缀批量列出已存在的文件，减少逐个文件的存在性检查
+	var existing *existingFiles
+	if !u.Overwrite {
+		existing = u.listExistingFiles(ready)
+	}
 
 	// 启动工作协程
 	numWorkers := concurrencyLimit
-	if len(filesToUpload) < concurrencyLimit {
-		numWorkers = len(filesToUpload)
+	if len(ready) < concurrencyLimit {
+		numWorkers = len(ready)
 	}
 
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			// 每个工作协程从 paths 队列中取出文件并上传
-			for localFile := range paths {
-				cleanLocalFile := filepath.Clean(localFile)
-				result := UploadResult{LocalFile: cleanLocalFile}
-
-				// 如果获取 uploadInfo 失败，则直接记录错误
-				if err != nil {
-					result.Error = fmt.Errorf("无法上传，B2 上传 URL 获取失败: %w", err)
-					results <- result
-					continue
-				}
-				// 1. 生成远程路径
-				remotePath, pathErr := util.GenerateRemotePath(cleanLocalFile, u.Config.User)
-				if pathErr != nil {
-					result.Error = fmt.Errorf("无法生成远程路径: %w", pathErr)
-					results <- result
-					continue
-				}
-
-				// 打印上传文件名称和远程路径信息
-				fmt.Printf("准备处理 %s 到 B2 路径: %s\n", filepath.Base(cleanLocalFile), remotePath)
-
-				// 2. 执行上传
-				publicURL, uploadErr := u.uploadSingleFile(cleanLocalFile, remotePath, uploadInfo)
-				if uploadErr != nil {
-					result.Error = uploadErr
-				} else {
-					result.PublicURL = publicURL
-					// 检查是否跳过：如果返回的 publicURL 是来自已存在文件，我们认为它被跳过了。
-					// 这里可以根据业务逻辑调整，但通常如果上传成功，exist是false，如果跳过，exist是true。
-					_, exists, _ := u.checkFileExists(remotePath)
-					if exists && uploadErr == nil {
-						result.Skipped = true
-					}
-				}
-				results <- result
+			// B2 禁止多个协程同时使用同一个上传 URL，每个工作协程持有自己的上传 URL 和 Token
+			var uploadInfo *UploadURLResponse
+			// 每个工作协程从 pending 队列中取出文件并上传，结果写入该文件在输入中的位置
+			for idx := range pending {
+				results[idx] = u.runJob(jobs[idx], existing, &uploadInfo)
 			}
 		}()
 	}
-	// 路径发送和通道关闭
-	for _, f := range filesToUpload {
-		paths <- f
+	// 任务发送和通道关闭
+	for i, job := range jobs {
+		if job != nil && errs[i] == nil {
+			pending <- i
+		}
 	}
-	close(paths)
+	close(pending)
 	// 等待所有工作协程完成
 	wg.Wait()
-	close(results)
-	return u.collectResults(results, len(filesToUpload))
+	return results
 }
 
-// collectResults 从结果通道中收集所有结果
-func (u *Uploader) collectResults(results chan UploadResult, count int) []UploadResult {
-	finalResults := make([]UploadResult, 0, count)
-	for res := range results {
-		finalResults = append(finalResults, res)
-	}
-	return finalResults
+// runJob 上传单个文件并生成上传结果
+func (u *Uploader) runJob(job *uploadJob, existing *existingFiles, uploadInfo **UploadURLResponse) UploadResult {
+	result := UploadResult{
+		LocalFile:   job.localFile,
+		RemotePath:  job.remotePath,
+		Size:        job.hashes.Size,
+		ContentType: job.contentType,
+		MD5:         job.hashes.MD5,
+		SHA1:        job.hashes.SHA1,
+	}
+
+	// 打印上传文件名称和远程路径信息
+	fmt.Fprintf(u.Log, "准备处理 %s 到 B2 路径: %s\n", filepath.Base(job.localFile), job.remotePath)
+
+	// 3. 执行上传，是否因已存在而跳过由上传过程直接返回
+	start := time.Now()
+	remotePath, skipped, err := u.uploadFile(job, existing, uploadInfo)
+	result.Duration = time.Since(start)
+	result.Skipped, result.Error = skipped, err
+	if err == nil {
+		// 断点续传的大文件沿用上次记录的远程路径
+		result.RemotePath = remotePath
+		result.PublicURL = u.buildPublicURL(remotePath)
+	}
+	return result
 }
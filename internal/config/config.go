@@ -2,43 +2,176 @@ package config
 
 import (
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/xa1st/b2upload/internal/util"
 )
 
 // Config 存储图床工具的所有配置信息
 type Config struct {
+	Tag    string // 配置标签名 (例如 custom)
 	User   string // 图床用户 (例如 delpub)
 	URL    string // 最终的文件公共下载 URL (例如 https://img.bsay.de)
 	Token  string // B2 Token
 	Bucket string // B2 Bucket 名称
+	APIURL string // B2 API 地址，授权请求发送到 APIURL/b2api/v3/b2_authorize_account
+
+	PathTemplate *util.PathTemplate // 远程路径模板
+
+	LargeFileThreshold int64 // 超过该大小 (字节) 的文件改用 B2 大文件分片接口上传
+	PartSize           int64 // 大文件分片大小 (字节)
+	PartConcurrency    int   // 单个大文件的分片并发上传数
+
+	MaxRetries     int           // B2 请求遇到临时错误时的最大重试次数
+	RetryBaseDelay time.Duration // 指数退避的初始等待时间
+	RetryMaxDelay  time.Duration // 指数退避的最长等待时间
 }
 
-// NewConfig 构造配置结构，并检查关键字段是否设置
-func NewConfig(user, url, token, bucket string) (*Config, error) {
+const (
+	// DefaultAPIURL 是 B2 官方的 API 地址
+	DefaultAPIURL = "https://api.backblazeb2.com"
+
+	// MinPartSize 是 B2 允许的最小分片大小 (最后一个分片除外)
+	MinPartSize int64 = 5 * 1024 * 1024
+	// MaxPartSize 是 B2 允许的最大分片大小
+	MaxPartSize int64 = 5 * 1024 * 1024 * 1024
+
+	// DefaultLargeFileThresholdMB 默认大文件阈值 (MB)
+	DefaultLargeFileThresholdMB = 200
+	// DefaultPartSizeMB 默认分片大小 (MB)，与 B2 推荐的分片大小一致
+	DefaultPartSizeMB = 100
+	// DefaultPartConcurrency 默认分片并发数
+	DefaultPartConcurrency = 4
+
+	// DefaultMaxRetries 默认最大重试次数
+	DefaultMaxRetries = 5
+	// DefaultRetryBaseDelay 默认指数退避初始等待时间
+	DefaultRetryBaseDelay = time.Second
+	// DefaultRetryMaxDelay 默认指数退避最长等待时间
+	DefaultRetryMaxDelay = 64 * time.Second
+)
+
+// defaultPathTemplate 是解析好的默认远程路径模板
+var defaultPathTemplate, _ = util.ParsePathTemplate(util.DefaultPathTemplate)
+
+// NewConfig 构造标签的配置结构 (各字段已合并标签和全局配置)，并检查关键字段是否设置
+func NewConfig(tag, user, url, token, bucket string) (*Config, error) {
 
 	cfg := &Config{
+		Tag:    tag,
 		User:   user,
 		URL:    url,
 		Token:  token,
 		Bucket: bucket,
+		APIURL: DefaultAPIURL,
+
+		PathTemplate: defaultPathTemplate,
+
+		LargeFileThreshold: DefaultLargeFileThresholdMB * 1024 * 1024,
+		PartSize:           DefaultPartSizeMB * 1024 * 1024,
+		PartConcurrency:    DefaultPartConcurrency,
+
+		MaxRetries:     DefaultMaxRetries,
+		RetryBaseDelay: DefaultRetryBaseDelay,
+		RetryMaxDelay:  DefaultRetryMaxDelay,
 	}
 
 	// 检查 Token
 	if cfg.Token == "" {
-		return nil, fmt.Errorf("错误: 图床Token未设置. 请确保在 b2upload.toml 文件根部设置 token 字段")
+		return nil, fmt.Errorf("错误: 标签 [%s] 的图床Token未设置. 请在 b2upload.toml 的 [tags.%s] 或文件根部设置 token 字段", tag, tag)
+	}
+	if !strings.Contains(cfg.Token, ":") {
+		return nil, fmt.Errorf("错误: 标签 [%s] 的 token 格式无效，应为 \"Key ID:Application Key\"", tag)
 	}
 
 	// 检查 Bucket
 	if cfg.Bucket == "" {
-		return nil, fmt.Errorf("错误: 图床Bucket未设置. 请确保在 b2upload.toml 文件根部设置 bucket 字段")
+		return nil, fmt.Errorf("错误: 标签 [%s] 的图床Bucket未设置. 请在 b2upload.toml 的 [tags.%s] 或文件根部设置 bucket 字段", tag, tag)
 	}
 
-	// 检查 User 和 URL (来自配置标签或 base_url 回退)
+	// 检查 User 和 URL (来自配置标签或 baseurl 回退)
 	if cfg.User == "" {
-		return nil, fmt.Errorf("错误: 缺少配置标签的用户(username)信息")
+		return nil, fmt.Errorf("错误: 缺少配置标签 [%s] 的用户(username)信息", tag)
 	}
 	if cfg.URL == "" {
-		return nil, fmt.Errorf("错误: 缺少配置标签的URL信息。请检查 b2upload.toml 中标签下的 url 字段或全局 base_url 字段")
+		return nil, fmt.Errorf("错误: 缺少配置标签 [%s] 的URL信息。请检查 b2upload.toml 中 [tags.%s] 下的 url 字段或全局 baseurl 字段", tag, tag)
 	}
 
 	return cfg, nil
 }
+
+// SetAPIURL 设置 B2 API 地址 (例如 https://api.backblazeb2.com)，为空时使用官方地址
+func (c *Config) SetAPIURL(raw string) error {
+	if raw == "" {
+		c.APIURL = DefaultAPIURL
+		return nil
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("错误: 标签 [%s] 的 api_url 配置无效: %q，应为 https://api.backblazeb2.com 这样的地址", c.Tag, raw)
+	}
+	c.APIURL = strings.TrimSuffix(raw, "/")
+	return nil
+}
+
+// SetLargeFileOptions 设置大文件分片上传参数 (阈值和分片大小以 MB 为单位)，并检查是否符合 B2 的限制
+func (c *Config) SetLargeFileOptions(thresholdMB, partSizeMB int64, concurrency int) error {
+	threshold := thresholdMB * 1024 * 1024
+	partSize := partSizeMB * 1024 * 1024
+
+	if partSize < MinPartSize || partSize > MaxPartSize {
+		return fmt.Errorf("错误: part_size 设置为 %d MB，超出 B2 允许的范围 (5 MB ~ 5120 MB)", partSizeMB)
+	}
+	// 阈值不能小于分片大小，否则会出现只有一个分片的“大文件”
+	if threshold < partSize {
+		return fmt.Errorf("错误: large_file_threshold (%d MB) 不能小于 part_size (%d MB)", thresholdMB, partSizeMB)
+	}
+	if concurrency < 1 {
+		return fmt.Errorf("错误: part_concurrency 必须大于 0，当前为 %d", concurrency)
+	}
+
+	c.LargeFileThreshold = threshold
+	c.PartSize = partSize
+	c.PartConcurrency = concurrency
+	return nil
+}
+
+// SetRetryOptions 设置 B2 请求的重试次数和指数退避等待时间
+func (c *Config) SetRetryOptions(maxRetries int, baseDelay, maxDelay time.Duration) error {
+	if maxRetries < 0 {
+		return fmt.Errorf("错误: retry.max_retries 不能小于 0，当前为 %d", maxRetries)
+	}
+	if baseDelay <= 0 {
+		return fmt.Errorf("错误: retry.base_delay 必须大于 0，当前为 %s", baseDelay)
+	}
+	if maxDelay < baseDelay {
+		return fmt.Errorf("错误: retry.max_delay (%s) 不能小于 retry.base_delay (%s)", maxDelay, baseDelay)
+	}
+
+	c.MaxRetries = maxRetries
+	c.RetryBaseDelay = baseDelay
+	c.RetryMaxDelay = maxDelay
+	return nil
+}
+
+// SetPreservePaths 使用 util.PreservePathsTemplate 按输入目录结构生成远程路径，覆盖配置的路径模板。
+// 该模板不含内容哈希，修改过的文件由上传时的大小和 SHA1 比较识别并上传为新版本
+func (c *Config) SetPreservePaths() {
+	c.PathTemplate, _ = util.ParsePathTemplate(util.PreservePathsTemplate)
+}
+
+// SetPathTemplate 解析并设置远程路径模板，为空时使用默认模板
+func (c *Config) SetPathTemplate(raw string) error {
+	if raw == "" {
+		c.PathTemplate = defaultPathTemplate
+		return nil
+	}
+	tmpl, err := util.ParsePathTemplate(raw)
+	if err != nil {
+		return fmt.Errorf("错误: 标签 [%s] 的 path_template 配置无效: %w", c.Tag, err)
+	}
+	c.PathTemplate = tmpl
+	return nil
+}
@@ -0,0 +1,156 @@
+package format
+
+import (
+	"fmt"
+	"html"
+	"image"
+	_ "image/gif" // 注册 GIF 解码器，用于读取图片尺寸
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// 支持的链接格式
+const (
+	Markdown = "markdown" // ![名称](URL)
+	HTML     = "html"     // <img src="URL" ...>
+	BBCode   = "bbcode"   // [img]URL[/img]
+	RST      = "rst"      // .. image:: URL
+	URL      = "url"      // 仅 URL
+	Template = "template" // 自定义 Go text/template 模板
+)
+
+// Names 是所有支持的格式名称，用于提示信息
+var Names = []string{Markdown, HTML, BBCode, RST, URL, Template}
+
+// Link 是渲染链接时可用的文件信息，也是自定义模板中可用的字段，例如 {{.URL}}、{{.Name}}、{{.Width}}
+type Link struct {
+	URL         string // 公开访问 URL
+	RemotePath  string // B2 中的文件名
+	LocalFile   string // 本地文件路径
+	Basename    string // 本地文件名 (含扩展名)
+	Name        string // 本地文件名 (不含扩展名)
+	Ext         string // 扩展名 (不带点)
+	ContentType string
+	Size        int64
+	MD5         string
+	SHA1        string
+	Skipped     bool // 远程已存在相同文件，未重复上传
+	IsImage     bool // Content Type 为 image/*
+	Width       int  // 图片宽度 (像素)，无法识别时为 0
+	Height      int  // 图片高度 (像素)，无法识别时为 0
+}
+
+// NewLink 根据本地文件和上传结果构造 Link，图片会读取文件头获取宽高 (支持 PNG、JPEG、GIF)
+func NewLink(localFile, remotePath, url, contentType string, size int64, md5, sha1 string, skipped bool) Link {
+	base := filepath.Base(localFile)
+	ext := filepath.Ext(base)
+	link := Link{
+		URL:         url,
+		RemotePath:  remotePath,
+		LocalFile:   localFile,
+		Basename:    base,
+		Name:        strings.TrimSuffix(base, ext),
+		Ext:         strings.TrimPrefix(ext, "."),
+		ContentType: contentType,
+		Size:        size,
+		MD5:         md5,
+		SHA1:        sha1,
+		Skipped:     skipped,
+		IsImage:     strings.HasPrefix(contentType, "image/"),
+	}
+	if link.IsImage {
+		link.Width, link.Height = ImageSize(localFile)
+	}
+	return link
+}
+
+// ImageSize 读取图片文件头获取宽高，格式不支持或读取失败时返回 0, 0
+func ImageSize(filePath string) (width, height int) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0
+	}
+	defer file.Close()
+	cfg, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0
+	}
+	return cfg.Width, cfg.Height
+}
+
+// Renderer 按指定格式将上传结果渲染为链接文本
+type Renderer struct {
+	kind string
+	tmpl *template.Template
+}
+
+// NewRenderer 创建指定格式的渲染器，kind 为 template 时 tmplText 为 Go text/template 模板
+func NewRenderer(kind, tmplText string) (*Renderer, error) {
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	if kind == "" && tmplText != "" {
+		kind = Template
+	}
+	switch kind {
+	case Markdown, HTML, BBCode, RST, URL:
+		return &Renderer{kind: kind}, nil
+	case Template:
+		if strings.TrimSpace(tmplText) == "" {
+			return nil, fmt.Errorf("使用 template 格式时必须提供模板 (--template 或 template 配置项)")
+		}
+		tmpl, err := template.New("link").Parse(tmplText)
+		if err != nil {
+			return nil, fmt.Errorf("链接模板无效: %w", err)
+		}
+		return &Renderer{kind: kind, tmpl: tmpl}, nil
+	}
+	return nil, fmt.Errorf("不支持的链接格式 %q，可选值为 %s", kind, strings.Join(Names, "、"))
+}
+
+// Render 渲染单个文件的链接
+func (r *Renderer) Render(link Link) (string, error) {
+	switch r.kind {
+	case Markdown:
+		if link.IsImage {
+			return fmt.Sprintf("![%s](%s)", link.Name, link.URL), nil
+		}
+		return fmt.Sprintf("[%s](%s)", link.Basename, link.URL), nil
+
+	case HTML:
+		if !link.IsImage {
+			return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(link.URL), html.EscapeString(link.Basename)), nil
+		}
+		tag := fmt.Sprintf(`<img src="%s" alt="%s"`, html.EscapeString(link.URL), html.EscapeString(link.Name))
+		if link.Width > 0 && link.Height > 0 {
+			tag += fmt.Sprintf(` width="%d" height="%d"`, link.Width, link.Height)
+		}
+		return tag + ">", nil
+
+	case BBCode:
+		if link.IsImage {
+			return fmt.Sprintf("[img]%s[/img]", link.URL), nil
+		}
+		return fmt.Sprintf("[url=%s]%s[/url]", link.URL, link.Basename), nil
+
+	case RST:
+		if !link.IsImage {
+			return fmt.Sprintf("`%s <%s>`_", link.Basename, link.URL), nil
+		}
+		lines := []string{".. image:: " + link.URL, "   :alt: " + link.Name}
+		if link.Width > 0 && link.Height > 0 {
+			lines = append(lines, fmt.Sprintf("   :width: %d", link.Width), fmt.Sprintf("   :height: %d", link.Height))
+		}
+		return strings.Join(lines, "\n"), nil
+
+	case Template:
+		var b strings.Builder
+		if err := r.tmpl.Execute(&b, link); err != nil {
+			return "", fmt.Errorf("渲染链接模板失败: %w", err)
+		}
+		return b.String(), nil
+	}
+	return link.URL, nil
+}
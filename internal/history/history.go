@@ -0,0 +1,150 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry 是一条上传记录
+type Entry struct {
+	ID          int       `json:"-"` // 记录在文件中的行号 (从 1 开始)，加载时填充
+	Time        time.Time `json:"time"`
+	Tag         string    `json:"tag"`
+	LocalFile   string    `json:"localFile"`
+	RemotePath  string    `json:"remotePath"`
+	URL         string    `json:"url"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"contentType,omitempty"`
+	MD5         string    `json:"md5,omitempty"`
+	SHA1        string    `json:"sha1,omitempty"`
+	Skipped     bool      `json:"skipped,omitempty"` // 远程已存在相同文件，未重复上传
+}
+
+// Store 是保存在本地 JSONL 文件中的上传历史，每行一条记录，只追加不修改
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Open 返回指定路径的历史记录 (文件在第一次写入时创建)
+func Open(path string) *Store {
+	return &Store{path: path}
+}
+
+// Path 返回历史记录文件路径
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Append 追加若干条记录
+func (s *Store) Append(entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("序列化上传历史失败: %w", err)
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("写入上传历史失败: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(b.String()); err != nil {
+		return fmt.Errorf("写入上传历史失败: %w", err)
+	}
+	return nil
+}
+
+// Load 读取所有记录 (按写入顺序)，无法解析的行会被跳过
+func (s *Store) Load() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取上传历史失败: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		e.ID = line
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取上传历史失败: %w", err)
+	}
+	return entries, nil
+}
+
+// Filter 是查询上传历史的条件，零值表示不限制
+type Filter struct {
+	Tag   string    // 配置标签
+	Since time.Time // 不早于该时间
+	Until time.Time // 早于该时间
+	Name  string    // 本地文件名通配符 (如 *.png)，不含通配符时按包含关系匹配
+	Query string    // 关键字，在本地路径、远程路径和 URL 中查找 (不区分大小写)
+}
+
+// Match 判断记录是否满足查询条件
+func (f Filter) Match(e Entry) bool {
+	if f.Tag != "" && e.Tag != f.Tag {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	if f.Name != "" {
+		base := baseName(e.LocalFile)
+		if strings.ContainsAny(f.Name, "*?[") {
+			if ok, _ := path.Match(strings.ToLower(f.Name), strings.ToLower(base)); !ok {
+				return false
+			}
+		} else if !strings.Contains(strings.ToLower(base), strings.ToLower(f.Name)) {
+			return false
+		}
+	}
+	if f.Query != "" {
+		q := strings.ToLower(f.Query)
+		if !strings.Contains(strings.ToLower(e.LocalFile), q) &&
+			!strings.Contains(strings.ToLower(e.RemotePath), q) &&
+			!strings.Contains(strings.ToLower(e.URL), q) {
+			return false
+		}
+	}
+	return true
+}
+
+// baseName 返回本地路径的文件名，同时兼容 / 和 \ 分隔符 (记录可能来自其他系统)
+func baseName(p string) string {
+	if i := strings.LastIndexAny(p, `/\`); i >= 0 {
+		return p[i+1:]
+	}
+	return p
+}
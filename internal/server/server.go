@@ -0,0 +1,383 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xa1st/b2upload/internal/b2"
+	"github.com/xa1st/b2upload/internal/util"
+)
+
+// DefaultListen 是默认的监听地址，与 PicGo-Server 的默认端口一致
+const DefaultListen = "127.0.0.1:36677"
+
+// DefaultMaxBodySize 是默认的请求体大小上限 (字节)
+const DefaultMaxBodySize = 100 << 20
+
+// UploaderFactory 为指定标签创建已完成 B2 授权的上传器
+type UploaderFactory func(tag string) (*b2.Uploader, error)
+
+// Server 是本地 HTTP 上传服务，兼容 PicGo-Server 的 JSON 请求和 ShareX 的 multipart 上传。
+// 每个标签只创建一次上传器并保持授权，授权过期时由上传器自动重新授权
+type Server struct {
+	DefaultTag  string    // 请求未指定 tag 参数时使用的标签
+	Token       string    // 不为空时要求请求携带 Authorization: Bearer <Token>
+	Listen      string    // 监听地址，不是本机回环地址时必须设置 Token；Host 头也可以是该地址
+	MaxBodySize int64     // 请求体大小上限 (字节)
+	Log         io.Writer // 请求日志
+	// OnUpload 在每个请求上传完成后调用 (例如记录上传历史)，可以为 nil
+	OnUpload func(tag string, results []b2.UploadResult)
+
+	newUploader UploaderFactory
+	mu          sync.Mutex
+	uploaders   map[string]*b2.Uploader
+}
+
+// New 创建上传服务
+func New(defaultTag, token string, newUploader UploaderFactory) *Server {
+	return &Server{
+		DefaultTag:  defaultTag,
+		Token:       token,
+		Listen:      DefaultListen,
+		MaxBodySize: DefaultMaxBodySize,
+		Log:         os.Stdout,
+		newUploader: newUploader,
+		uploaders:   make(map[string]*b2.Uploader),
+	}
+}
+
+// Handler 返回服务的 HTTP 路由：
+//
+//	POST /upload     上传文件 (JSON {"list": [本地路径]}、multipart 表单或原始请求体)
+//	POST /heartbeat  PicGo 的存活检查
+//
+// 所有请求都会检查 Host 和 Origin 头，拒绝 DNS 重绑定和其他网站发起的跨域请求
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/upload", s.handleUpload)
+	mux.HandleFunc("/heartbeat", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "result": "alive"})
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.allowedHost(r.Host) {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("不允许的 Host: %s", r.Host))
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" && !s.allowedOrigin(origin) {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("不允许跨域请求: %s", origin))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// RequiresToken 判断是否必须设置 Token：监听地址不是本机回环地址时，局域网中的其他设备也可以访问服务
+func (s *Server) RequiresToken() bool {
+	host, _, err := net.SplitHostPort(s.Listen)
+	if err != nil {
+		host = s.Listen
+	}
+	return !isLoopback(host)
+}
+
+// isLoopback 判断主机名是否为本机回环地址
+func isLoopback(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// allowedHost 检查请求的 Host 头 (可带端口)：只接受回环地址和监听地址，
+// 监听所有网卡 (0.0.0.0 或 ::) 时必须设置 Token，因此接受任意 Host
+func (s *Server) allowedHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	if isLoopback(host) {
+		return true
+	}
+	listenHost, _, err := net.SplitHostPort(s.Listen)
+	if err != nil {
+		listenHost = s.Listen
+	}
+	if ip := net.ParseIP(listenHost); listenHost == "" || (ip != nil && ip.IsUnspecified()) {
+		return s.Token != ""
+	}
+	return strings.EqualFold(strings.Trim(host, "[]"), strings.Trim(listenHost, "[]"))
+}
+
+// allowedOrigin 检查浏览器发送的 Origin 头，只允许来自服务自身地址的页面
+func (s *Server) allowedOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false // 包括 Origin: null
+	}
+	return s.allowedHost(u.Host)
+}
+
+// fileResult 是响应中单个文件的上传结果
+type fileResult struct {
+	File       string     `json:"file"`
+	URL        string     `json:"url,omitempty"`
+	RemotePath string     `json:"remotePath,omitempty"`
+	Size       int64      `json:"size,omitempty"`
+	Skipped    bool       `json:"skipped,omitempty"`
+	Error      *errorInfo `json:"error,omitempty"`
+}
+
+// errorInfo 是响应中的错误信息
+type errorInfo struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// uploadResponse 是 /upload 的响应。success 和 result 字段与 PicGo-Server 一致，result 为按请求顺序排列的 URL
+type uploadResponse struct {
+	Success bool         `json:"success"`
+	Result  []string     `json:"result"`
+	Files   []fileResult `json:"files,omitempty"`
+	Message string       `json:"message,omitempty"`
+}
+
+// handleUpload 处理上传请求，标签由 tag 查询参数指定
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "只支持 POST 请求")
+		return
+	}
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "缺少或错误的 Bearer Token")
+		return
+	}
+	// PicGo 的 JSON 请求按本地路径读取文件，必须设置 Token，避免任意本地文件被上传
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" && s.Token == "" {
+		writeError(w, http.StatusForbidden, "按本地路径上传 ({\"list\": [...]}) 需要通过 --auth-token 设置 Token")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.MaxBodySize)
+
+	tag := r.URL.Query().Get("tag")
+	if tag == "" {
+		tag = s.DefaultTag
+	}
+	if tag == "" {
+		writeError(w, http.StatusBadRequest, "请通过 tag 参数指定配置标签")
+		return
+	}
+
+	// 收集待上传的文件：PicGo 传本地路径，multipart 和原始请求体先保存到临时目录
+	tmpDir, err := os.MkdirTemp("", "b2upload-serve-")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("创建临时目录失败: %v", err))
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	files, err := s.readFiles(r, tmpDir)
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	if len(files) == 0 {
+		writeError(w, http.StatusBadRequest, "请求中没有要上传的文件")
+		return
+	}
+
+	uploader, err := s.Uploader(tag)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	start := time.Now()
+	results := uploader.UploadFiles(files)
+	if s.OnUpload != nil {
+		s.OnUpload(tag, results)
+	}
+	resp := uploadResponse{Success: true, Result: make([]string, 0, len(results))}
+	for i, res := range results {
+		item := fileResult{File: files[i].Rel, RemotePath: res.RemotePath, Size: res.Size, Skipped: res.Skipped}
+		if res.Error != nil {
+			resp.Success = false
+			item.Error = &errorInfo{Code: b2.ErrorCode(res.Error), Message: res.Error.Error()}
+			fmt.Fprintf(s.Log, "[%s] 上传失败 %s: %v\n", tag, files[i].Rel, res.Error)
+		} else {
+			item.URL = res.PublicURL
+			resp.Result = append(resp.Result, res.PublicURL)
+			fmt.Fprintf(s.Log, "[%s] 上传成功 %s -> %s\n", tag, files[i].Rel, res.PublicURL)
+		}
+		resp.Files = append(resp.Files, item)
+	}
+	if !resp.Success {
+		resp.Message = fmt.Sprintf("%d 个文件中有 %d 个上传失败", len(results), len(results)-len(resp.Result))
+	}
+	fmt.Fprintf(s.Log, "[%s] 处理 %d 个文件，用时 %.2f 秒\n", tag, len(results), time.Since(start).Seconds())
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// authorized 检查 Bearer Token，未配置 Token 时只允许监听在回环地址的服务不做校验
+func (s *Server) authorized(r *http.Request) bool {
+	if s.Token == "" {
+		return !s.RequiresToken()
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got)), []byte(s.Token)) == 1
+}
+
+// Uploader 返回指定标签的上传器，首次使用时创建并授权
+func (s *Server) Uploader(tag string) (*b2.Uploader, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.uploaders[tag]; ok {
+		return u, nil
+	}
+	u, err := s.newUploader(tag)
+	if err != nil {
+		return nil, err
+	}
+	s.uploaders[tag] = u
+	return u, nil
+}
+
+// readFiles 按请求的 Content-Type 读取待上传的文件
+func (s *Server) readFiles(r *http.Request, tmpDir string) ([]util.SourceFile, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/json":
+		return readPicGoList(r.Body)
+	case strings.HasPrefix(mediaType, "multipart/"):
+		return readMultipart(r, tmpDir)
+	default:
+		return readRawBody(r, mediaType, tmpDir)
+	}
+}
+
+// readPicGoList 读取 PicGo-Server 格式的请求体 {"list": ["本地文件路径", ...]}
+func readPicGoList(body io.Reader) ([]util.SourceFile, error) {
+	var req struct {
+		List []string `json:"list"`
+	}
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		return nil, fmt.Errorf("解析 JSON 请求体失败: %w", err)
+	}
+	files := make([]util.SourceFile, 0, len(req.List))
+	for _, path := range req.List {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("无法读取文件 %s: %w", path, err)
+		}
+		if !stat.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s 不是普通文件", path)
+		}
+		files = append(files, util.SourceFile{Path: path, Rel: filepath.Base(path)})
+	}
+	return files, nil
+}
+
+// readMultipart 将 multipart 表单中的所有文件保存到临时目录 (ShareX 等工具使用这种方式上传)
+func readMultipart(r *http.Request, tmpDir string) ([]util.SourceFile, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("解析 multipart 请求失败: %w", err)
+	}
+	var files []util.SourceFile
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取 multipart 请求失败: %w", err)
+		}
+		if part.FileName() == "" {
+			part.Close()
+			continue // 普通表单字段
+		}
+		file, err := saveTemp(tmpDir, len(files), part.FileName(), part.Header.Get("Content-Type"), part)
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// readRawBody 将原始请求体保存为临时文件，文件名取自 name 查询参数或 Content-Disposition 头
+func readRawBody(r *http.Request, mediaType, tmpDir string) ([]util.SourceFile, error) {
+	if r.ContentLength == 0 {
+		return nil, nil
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil {
+			name = params["filename"]
+		}
+	}
+	file, err := saveTemp(tmpDir, 0, name, mediaType, r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return []util.SourceFile{file}, nil
+}
+
+// saveTemp 将上传的数据保存到临时目录，尽量保留原始文件名 (路径模板中的 {original_name} 等依赖文件名)，
+// 没有文件名时按 Content-Type 推断扩展名
+func saveTemp(tmpDir string, index int, name, contentType string, data io.Reader) (util.SourceFile, error) {
+	name = filepath.Base(filepath.FromSlash(strings.ReplaceAll(name, "\\", "/")))
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		name = "upload"
+		if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+
+	// 每个文件放在单独的子目录中，避免同名文件互相覆盖
+	dir := filepath.Join(tmpDir, fmt.Sprint(index))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return util.SourceFile{}, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	path := filepath.Join(dir, name)
+	file, err := os.Create(path)
+	if err != nil {
+		return util.SourceFile{}, fmt.Errorf("保存上传文件失败: %w", err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, data); err != nil {
+		return util.SourceFile{}, fmt.Errorf("保存上传文件失败: %w", err)
+	}
+	return util.SourceFile{Path: path, Rel: name}, nil
+}
+
+// writeJSON 输出 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError 输出错误响应
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, uploadResponse{Success: false, Result: []string{}, Message: message})
+}
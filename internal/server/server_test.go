@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xa1st/b2upload/internal/b2"
+)
+
+// errNoUploader 表示请求通过了所有检查，到达了创建上传器的步骤
+var errNoUploader = errors.New("no uploader")
+
+func newTestServer(listen, token string) *Server {
+	s := New("custom", token, func(tag string) (*b2.Uploader, error) {
+		return nil, errNoUploader
+	})
+	s.Listen = listen
+	s.Log = io.Discard
+	return s
+}
+
+func TestServerRequestChecks(t *testing.T) {
+	tests := []struct {
+		name        string
+		listen      string
+		token       string
+		host        string
+		header      map[string]string
+		contentType string
+		body        string
+		want        int
+	}{
+		{name: "loopback raw upload without token", host: "127.0.0.1:36677", contentType: "image/png", body: "png", want: http.StatusInternalServerError},
+		{name: "localhost host", host: "localhost:36677", contentType: "image/png", body: "png", want: http.StatusInternalServerError},
+		{name: "IPv6 loopback host", host: "[::1]:36677", contentType: "image/png", body: "png", want: http.StatusInternalServerError},
+		{name: "DNS rebinding host", host: "evil.example.com:36677", contentType: "image/png", body: "png", want: http.StatusForbidden},
+		{name: "cross-origin request", host: "127.0.0.1:36677", header: map[string]string{"Origin": "https://evil.example.com"}, contentType: "text/plain", body: "x", want: http.StatusForbidden},
+		{name: "null origin", host: "127.0.0.1:36677", header: map[string]string{"Origin": "null"}, contentType: "text/plain", body: "x", want: http.StatusForbidden},
+		{name: "same origin", host: "127.0.0.1:36677", header: map[string]string{"Origin": "http://127.0.0.1:36677"}, contentType: "image/png", body: "png", want: http.StatusInternalServerError},
+		{name: "list mode without token", host: "127.0.0.1:36677", contentType: "application/json", body: `{"list":["/etc/passwd"]}`, want: http.StatusForbidden},
+		{name: "list mode with wrong token", token: "secret", host: "127.0.0.1:36677", header: map[string]string{"Authorization": "Bearer nope"}, contentType: "application/json", body: `{"list":["/etc/passwd"]}`, want: http.StatusUnauthorized},
+		{name: "list mode with token but missing file", token: "secret", host: "127.0.0.1:36677", header: map[string]string{"Authorization": "Bearer secret"}, contentType: "application/json", body: `{"list":["/nonexistent/file.png"]}`, want: http.StatusBadRequest},
+		{name: "missing token", token: "secret", host: "127.0.0.1:36677", contentType: "image/png", body: "png", want: http.StatusUnauthorized},
+		{name: "LAN listen without token", listen: "0.0.0.0:36677", host: "192.168.1.2:36677", contentType: "image/png", body: "png", want: http.StatusForbidden},
+		{name: "LAN listen with token", listen: "0.0.0.0:36677", token: "secret", host: "192.168.1.2:36677", header: map[string]string{"Authorization": "Bearer secret"}, contentType: "image/png", body: "png", want: http.StatusInternalServerError},
+		{name: "listen address as host", listen: "192.168.1.2:36677", token: "secret", host: "192.168.1.2:36677", header: map[string]string{"Authorization": "Bearer secret"}, contentType: "image/png", body: "png", want: http.StatusInternalServerError},
+		{name: "other host with specific listen address", listen: "192.168.1.2:36677", token: "secret", host: "evil.example.com", header: map[string]string{"Authorization": "Bearer secret"}, contentType: "image/png", body: "png", want: http.StatusForbidden},
+		{name: "body too large", host: "127.0.0.1:36677", contentType: "image/png", body: strings.Repeat("x", 2048), want: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		listen := tt.listen
+		if listen == "" {
+			listen = DefaultListen
+		}
+		s := newTestServer(listen, tt.token)
+		s.MaxBodySize = 1024
+		req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(tt.body))
+		req.Host = tt.host
+		req.Header.Set("Content-Type", tt.contentType)
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: 状态码 %d，期望 %d，响应: %s", tt.name, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+}
+
+func TestServerRequiresToken(t *testing.T) {
+	for listen, want := range map[string]bool{
+		"127.0.0.1:36677":   false,
+		"localhost:36677":   false,
+		"[::1]:36677":       false,
+		"0.0.0.0:36677":     true,
+		":36677":            true,
+		"192.168.1.2:36677": true,
+	} {
+		if got := (&Server{Listen: listen}).RequiresToken(); got != want {
+			t.Errorf("RequiresToken(%q) = %v，期望 %v", listen, got, want)
+		}
+	}
+}
+
+func TestServerHeartbeat(t *testing.T) {
+	s := newTestServer(DefaultListen, "")
+	req := httptest.NewRequest(http.MethodPost, "/heartbeat", nil)
+	req.Host = "127.0.0.1:36677"
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "alive") {
+		t.Errorf("heartbeat 响应 %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -2,29 +2,74 @@ package util
 
 import (
 	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
 	"fmt"
 	"io"
+	"mime"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 )
 
-// FindFiles 根据给定的路径或模式查找文件
-// 支持文件名、文件夹名或通配符模式 (如 *.png)
-func FindFiles(pathOrPattern string) ([]string, error) {
-	if pathOrPattern == "" {
-		return nil, fmt.Errorf("文件路径或模式不能为空")
+// SourceFile 是待上传的本地文件，以及它相对于输入根目录的路径
+type SourceFile struct {
+	Path string // 本地文件路径
+	Rel  string // 相对于输入根目录 (文件夹参数或通配符所在目录) 的路径，使用 / 分隔
+}
+
+// globRoot 返回通配符模式中第一个通配符之前的目录部分，例如 ./images/*.png 返回 ./images
+func globRoot(pattern string) string {
+	dir := filepath.Dir(pattern)
+	for hasMeta(dir) {
+		dir = filepath.Dir(dir)
 	}
+	return dir
+}
 
-	// 检查是否是文件夹
-	if stat, err := os.Stat(pathOrPattern); err == nil && stat.IsDir() {
-		// 如果是文件夹，查找所有文件
-		return filepath.Glob(filepath.Join(pathOrPattern, "*"))
+// relPath 返回 path 相对于 root 的路径 (使用 / 分隔)，无法计算时返回文件名
+func relPath(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return filepath.Base(path)
 	}
+	return filepath.ToSlash(rel)
+}
 
-	// 按模式查找 (包括单个文件名)
-	return filepath.Glob(pathOrPattern)
+// WriteFileAtomic 将数据写入同目录下的临时文件后再重命名为 path，避免进程中断时留下损坏的文件
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// FormatSize 将字节数格式化为便于阅读的大小，例如 1.5 MB
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, exp := float64(size)/unit, 0
+	for value >= unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "KMGTP"[exp])
 }
 
 // GetFileExt 获取文件扩展名，不带点
@@ -36,39 +81,50 @@ func GetFileExt(filePath string) string {
 	return ""
 }
 
-// GenerateRemotePath 生成 Backblaze B2 期望的远程文件路径
-// 格式：[用户名]/[当前年份4位]/[当前月日]/[16位md5(文件名)].[扩展名]
-func GenerateRemotePath(localFile, user string) (string, error) {
-	// 计算文件的md5
-	hash, error := CalculateFileMD5(localFile)
-	if error != nil {
-		return "", error
+// ContentType 根据扩展名猜测文件的 Content Type
+func ContentType(filePath string) string {
+	contentType := mime.TypeByExtension(strings.ToLower(filepath.Ext(filePath)))
+	if contentType == "" {
+		contentType = "application/octet-stream"
 	}
-	hashStr := fmt.Sprintf("%x", hash)[:16] // 取前16位
-	// 取扩展名
-	ext := "." + GetFileExt(localFile)
-	// 获取当前时间信息
-	now := time.Now()
-	year := now.Format("2006")
-	monthDay := now.Format("0102")
-	// 组合路径：[用户名]/[年份]/[月日]/[md5].[扩展名]
-	remotePath := filepath.Join(user, year, monthDay, hashStr+ext)
-	// B2 要求路径分隔符为 /
-	return strings.ReplaceAll(remotePath, "\\", "/"), nil
+	return contentType
+}
+
+// FileHashes 是读取一遍文件得到的大小和哈希值
+type FileHashes struct {
+	Size   int64  // 文件大小 (字节)
+	MD5    string // 用于文件命名
+	SHA1   string // 用于 B2 的 X-Bz-Content-Sha1 校验
+	SHA256 string // 仅在路径模板用到 {sha256} 时计算
 }
 
-// CalculateFileMD5 计算文件的 MD5 值 (用于 B2 的 X-Bz-Content-Md5 校验)
-func CalculateFileMD5(filePath string) (string, error) {
+// HashFile 读取一遍文件，同时计算大小、MD5 和 SHA1 (withSHA256 为 true 时同时计算 SHA256)
+func HashFile(filePath string, withSHA256 bool) (*FileHashes, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return "", fmt.Errorf("无法打开文件进行MD5计算: %w", err)
+		return nil, fmt.Errorf("无法打开文件进行哈希计算: %w", err)
 	}
 	defer file.Close()
 
-	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", fmt.Errorf("计算文件MD5时出错: %w", err)
+	md5Hash := md5.New()
+	sha1Hash := sha1.New()
+	writers := []io.Writer{md5Hash, sha1Hash}
+	sha256Hash := sha256.New()
+	if withSHA256 {
+		writers = append(writers, sha256Hash)
+	}
+	size, err := io.Copy(io.MultiWriter(writers...), file)
+	if err != nil {
+		return nil, fmt.Errorf("计算文件哈希时出错: %w", err)
 	}
 
-	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+	hashes := &FileHashes{
+		Size: size,
+		MD5:  fmt.Sprintf("%x", md5Hash.Sum(nil)),
+		SHA1: fmt.Sprintf("%x", sha1Hash.Sum(nil)),
+	}
+	if withSHA256 {
+		hashes.SHA256 = fmt.Sprintf("%x", sha256Hash.Sum(nil))
+	}
+	return hashes, nil
 }
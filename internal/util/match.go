@@ -0,0 +1,163 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFileName 是目录中用于排除文件的忽略文件名，语法与 .gitignore 相同
+const IgnoreFileName = ".b2ignore"
+
+// MatchPattern 判断以 / 分隔的路径是否匹配通配符模式。
+// 除 path.Match 支持的 * ? [...] 外，独立的 ** 路径段可匹配零个或多个目录
+func MatchPattern(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchSegments 逐段匹配模式和路径
+func matchSegments(patterns, names []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			// 连续的 ** 等价于一个
+			for len(patterns) > 0 && patterns[0] == "**" {
+				patterns = patterns[1:]
+			}
+			if len(patterns) == 0 {
+				return true
+			}
+			for i := 0; i <= len(names); i++ {
+				if matchSegments(patterns, names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if ok, err := path.Match(patterns[0], names[0]); err != nil || !ok {
+			return false
+		}
+		patterns = patterns[1:]
+		names = names[1:]
+	}
+	return len(names) == 0
+}
+
+// hasMeta 判断字符串中是否包含通配符
+func hasMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// matchFilter 判断相对路径是否匹配 --include / --exclude 模式：
+// 模式中包含 / 时匹配完整的相对路径，否则只匹配文件名 (任意层级)
+func matchFilter(pattern, rel string) bool {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+	if strings.Contains(pattern, "/") {
+		return MatchPattern(strings.TrimPrefix(pattern, "/"), rel)
+	}
+	return MatchPattern(pattern, path.Base(rel))
+}
+
+// ignoreRule 是忽略文件中的一条规则
+type ignoreRule struct {
+	base     string // 忽略文件所在目录相对于查找根目录的路径，根目录为空字符串
+	pattern  string
+	negate   bool // 以 ! 开头：重新包含之前被排除的文件
+	dirOnly  bool // 以 / 结尾：只匹配目录
+	anchored bool // 包含 /：相对于忽略文件所在目录匹配，否则匹配任意层级的名称
+}
+
+// ignoreList 是按加载顺序排列的忽略规则，后面的规则优先
+type ignoreList struct {
+	rules []ignoreRule
+}
+
+// load 读取 dir 目录中的忽略文件 (不存在时忽略)，relDir 为该目录相对于查找根目录的路径
+func (l *ignoreList) load(dir, relDir string) error {
+	file, err := os.Open(filepath.Join(dir, IgnoreFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: relDir}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:] // \# 或 \! 表示字面量
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		l.rules = append(l.rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取 %s 失败: %w", filepath.Join(dir, IgnoreFileName), err)
+	}
+	return nil
+}
+
+// ignored 判断相对路径是否被忽略。与 gitignore 一致，父目录被忽略时其中的文件无法被重新包含
+func (l *ignoreList) ignored(rel string, isDir bool) bool {
+	if l == nil || len(l.rules) == 0 {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if l.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return l.match(rel, isDir)
+}
+
+// match 按规则顺序匹配单个路径，最后一条匹配的规则决定结果
+func (l *ignoreList) match(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range l.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		target := rel
+		if rule.base != "" {
+			if !strings.HasPrefix(rel, rule.base+"/") {
+				continue
+			}
+			target = strings.TrimPrefix(rel, rule.base+"/")
+		}
+		var matched bool
+		if rule.anchored {
+			matched = MatchPattern(rule.pattern, target)
+		} else {
+			matched = MatchPattern(rule.pattern, path.Base(target))
+		}
+		if matched {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,206 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.png", "a.png", true},
+		{"*.png", "a.jpg", false},
+		{"*.png", "dir/a.png", false},
+		{"a?c", "abc", true},
+		{"[ab].txt", "b.txt", true},
+		{"[ab].txt", "c.txt", false},
+		{"assets/*.png", "assets/a.png", true},
+		{"assets/*.png", "assets/sub/a.png", false},
+		{"assets/**/*.png", "assets/a.png", true},
+		{"assets/**/*.png", "assets/x/y/a.png", true},
+		{"assets/**/*.png", "other/a.png", false},
+		{"**/*.png", "a.png", true},
+		{"**/*.png", "x/y/a.png", true},
+		{"**", "x/y/z", true},
+		{"tmp/**", "tmp/a/b", true},
+		{"tmp/**", "tmp", true},
+		{"tmp/**", "tmpx/a", false},
+		{"a/**/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x/y/c", false},
+		{"[", "[", false}, // 无效模式不匹配
+	}
+	for _, tt := range tests {
+		if got := MatchPattern(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("MatchPattern(%q, %q) = %v，期望 %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFindOptionsMatches(t *testing.T) {
+	tests := []struct {
+		name string
+		opts FindOptions
+		rel  string
+		want bool
+	}{
+		{"no filters", FindOptions{}, "a/b.png", true},
+		{"include by name at any depth", FindOptions{Include: []string{"*.png"}}, "a/b/c.png", true},
+		{"include mismatch", FindOptions{Include: []string{"*.png"}}, "a/b/c.jpg", false},
+		{"any include matches", FindOptions{Include: []string{"*.png", "*.jpg"}}, "c.jpg", true},
+		{"include with slash matches full path", FindOptions{Include: []string{"img/*.png"}}, "img/a.png", true},
+		{"include with slash is anchored", FindOptions{Include: []string{"img/*.png"}}, "x/img/a.png", false},
+		{"leading ./ and / are ignored", FindOptions{Include: []string{"./img/*.png", "/doc/*.md"}}, "doc/a.md", true},
+		{"exclude by name", FindOptions{Exclude: []string{"*.tmp"}}, "x/a.tmp", false},
+		{"exclude beats include", FindOptions{Include: []string{"*.png"}, Exclude: []string{"secret*"}}, "secret.png", false},
+		{"exclude directory tree", FindOptions{Exclude: []string{"tmp/**"}}, "tmp/a/b.png", false},
+		{"exclude directory tree leaves others", FindOptions{Exclude: []string{"tmp/**"}}, "src/tmp.png", true},
+		{"hidden file skipped", FindOptions{}, ".env", false},
+		{"file in hidden directory skipped", FindOptions{}, ".git/a.png", false},
+		{"hidden allowed", FindOptions{Hidden: true}, ".git/a.png", true},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.Matches(tt.rel); got != tt.want {
+			t.Errorf("%s: Matches(%q) = %v，期望 %v", tt.name, tt.rel, got, tt.want)
+		}
+	}
+}
+
+// writeTree 在 root 下创建文件，路径使用 / 分隔
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		full := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// findRel 查找文件并返回排序后的相对路径
+func findRel(t *testing.T, pathOrPattern string, opts FindOptions) []string {
+	t.Helper()
+	files, err := FindFiles(pathOrPattern, opts)
+	if err != nil {
+		t.Fatalf("FindFiles(%q) 出错: %v", pathOrPattern, err)
+	}
+	var rels []string
+	for _, f := range files {
+		rels = append(rels, f.Rel)
+	}
+	slices.Sort(rels)
+	return rels
+}
+
+func TestFindFilesIgnoreFile(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		IgnoreFileName: `# 注释和空行会被忽略
+
+*.log
+!keep.log
+build/
+!build/keep.png
+/top.txt
+docs/**/draft*
+\#hash.txt
+`,
+		"a.png":                 "",
+		"c.log":                 "",
+		"keep.log":              "",
+		"top.txt":               "",
+		"#hash.txt":             "",
+		"build/z.png":           "",
+		"build/keep.png":        "",
+		"docs/draft0.md":        "",
+		"docs/a/b/draft1.md":    "",
+		"docs/a/final.md":       "",
+		"sub/top.txt":           "",
+		"sub/x.log":             "",
+		"sub/build":             "", // 普通文件不受只匹配目录的 build/ 影响
+		"sub/y.jpg":             "",
+		"sub/z.png":             "",
+		"sub/" + IgnoreFileName: "*.jpg\n!z.png\n",
+		"other/y.jpg":           "", // 子目录的忽略文件只作用于该目录
+		".hidden/h.png":         "",
+	})
+
+	got := findRel(t, root, FindOptions{Recursive: true})
+	want := []string{"a.png", "docs/a/final.md", "keep.log", "other/y.jpg", "sub/build", "sub/top.txt", "sub/z.png"}
+	if !slices.Equal(got, want) {
+		t.Errorf("FindFiles = %q\n期望 %q", got, want)
+	}
+
+	got = findRel(t, root, FindOptions{})
+	want = []string{"a.png", "keep.log"}
+	if !slices.Equal(got, want) {
+		t.Errorf("不递归时 FindFiles = %q\n期望 %q", got, want)
+	}
+}
+
+func TestFindFilesIncludeExclude(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"a.png":           "",
+		"b.jpg":           "",
+		"cache/c.png":     "",
+		"img/d.png":       "",
+		"img/sub/e.png":   "",
+		"img/secret.png":  "",
+		".hidden/f.png":   "",
+		"img/.g.png":      "",
+		"img/sub/h.webp":  "",
+		"docs/readme.txt": "",
+	})
+
+	tests := []struct {
+		name          string
+		pathOrPattern string
+		opts          FindOptions
+		want          []string
+	}{
+		{
+			name:          "include and exclude",
+			pathOrPattern: root,
+			opts:          FindOptions{Recursive: true, Include: []string{"*.png"}, Exclude: []string{"cache", "secret*"}},
+			want:          []string{"a.png", "img/d.png", "img/sub/e.png"},
+		},
+		{
+			name:          "anchored include",
+			pathOrPattern: root,
+			opts:          FindOptions{Recursive: true, Include: []string{"img/*.png"}},
+			want:          []string{"img/d.png", "img/secret.png"},
+		},
+		{
+			name:          "hidden",
+			pathOrPattern: root,
+			opts:          FindOptions{Recursive: true, Hidden: true, Include: []string{"*.png"}},
+			want:          []string{".hidden/f.png", "a.png", "cache/c.png", "img/.g.png", "img/d.png", "img/secret.png", "img/sub/e.png"},
+		},
+		{
+			name:          "double star pattern",
+			pathOrPattern: filepath.Join(root, "img", "**", "*.png"),
+			opts:          FindOptions{Exclude: []string{"secret*"}},
+			want:          []string{"d.png", "sub/e.png"},
+		},
+		{
+			name:          "glob",
+			pathOrPattern: filepath.Join(root, "*.*"),
+			opts:          FindOptions{Exclude: []string{"*.jpg"}},
+			want:          []string{"a.png"},
+		},
+	}
+	for _, tt := range tests {
+		got := findRel(t, tt.pathOrPattern, tt.opts)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: FindFiles = %q\n期望 %q", tt.name, got, tt.want)
+		}
+	}
+}
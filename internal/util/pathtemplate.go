@@ -0,0 +1,298 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PreservePathsTemplate 是 --preserve-paths 模式使用的模板，按输入目录结构保存到用户名前缀下
+const PreservePathsTemplate = "{user}/{relpath}"
+
+// DefaultPathTemplate 是未配置 path_template 时使用的远程路径模板，
+// 即 [用户名]/[年份4位]/[月日]/[16位md5].[扩展名]
+const DefaultPathTemplate = "{user}/{yyyy}/{mm}{dd}/{md5:16}.{ext}"
+
+// PathTemplate 是解析后的远程路径模板，例如 {user}/{yyyy}/{mm}/{original_name}
+//
+// 支持的占位符：
+//
+//	{user} {tag}                        用户名 (目录前缀) 和配置标签名
+//	{yyyy} {yy} {mm} {dd} {hh} {mi} {ss} 上传时间的各个部分
+//	{timestamp}                         上传时间的 Unix 秒数
+//	{md5} {sha1} {sha256}               文件内容哈希，可用 {md5:16} 截取前 N 位
+//	{original_name}                     原始文件名 (含扩展名)
+//	{name}                              原始文件名 (不含扩展名)
+//	{slug}                              规范化后的文件名 (小写，非字母数字替换为 -)
+//	{ext} {.ext}                        扩展名 (不带点 / 带点，无扩展名时为空)
+//	{dir}                               文件所在目录的名称
+//	{relpath} {reldir}                  相对于输入根目录的路径 (含文件名) 和目录部分
+//	{uuid}                              随机 UUID (v4)
+//	{rand}                              随机十六进制字符串，可用 {rand:N} 指定长度 (默认 8)
+type PathTemplate struct {
+	raw   string
+	parts []templatePart
+}
+
+// templatePart 是模板中的一段：纯文本或占位符
+type templatePart struct {
+	literal string
+	name    string // 占位符名称，为空表示纯文本
+	length  int    // 占位符的长度参数，0 表示未指定
+}
+
+// placeholderMaxLen 记录支持长度参数的占位符及其最大长度 (0 表示不限)
+var placeholderMaxLen = map[string]int{
+	"md5":    32,
+	"sha1":   40,
+	"sha256": 64,
+	"rand":   0,
+}
+
+// knownPlaceholders 是不支持长度参数的占位符
+var knownPlaceholders = map[string]bool{
+	"user": true, "tag": true,
+	"yyyy": true, "yy": true, "mm": true, "dd": true, "hh": true, "mi": true, "ss": true, "timestamp": true,
+	"original_name": true, "name": true, "slug": true, "ext": true, ".ext": true, "dir": true, "uuid": true,
+	"relpath": true, "reldir": true,
+}
+
+// ParsePathTemplate 解析并校验远程路径模板
+func ParsePathTemplate(raw string) (*PathTemplate, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, fmt.Errorf("路径模板不能为空")
+	}
+	if strings.HasPrefix(raw, "/") {
+		return nil, fmt.Errorf("路径模板不能以 / 开头")
+	}
+
+	t := &PathTemplate{raw: raw}
+	rest := raw
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		closeIdx := strings.IndexByte(rest, '}')
+		if open < 0 {
+			if closeIdx >= 0 {
+				return nil, fmt.Errorf("路径模板 %q 中存在多余的 }", raw)
+			}
+			t.parts = append(t.parts, templatePart{literal: rest})
+			break
+		}
+		if closeIdx >= 0 && closeIdx < open {
+			return nil, fmt.Errorf("路径模板 %q 中存在多余的 }", raw)
+		}
+		if open > 0 {
+			t.parts = append(t.parts, templatePart{literal: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("路径模板 %q 中的 { 没有对应的 }", raw)
+		}
+		part, err := parsePlaceholder(rest[open+1 : open+end])
+		if err != nil {
+			return nil, fmt.Errorf("路径模板 %q 无效: %w", raw, err)
+		}
+		t.parts = append(t.parts, part)
+		rest = rest[open+end+1:]
+	}
+	return t, nil
+}
+
+// parsePlaceholder 解析 {name} 或 {name:N} 中的内容
+func parsePlaceholder(body string) (templatePart, error) {
+	name, lengthStr, hasLength := strings.Cut(body, ":")
+	if !hasLength {
+		if knownPlaceholders[name] {
+			return templatePart{name: name}, nil
+		}
+		if _, ok := placeholderMaxLen[name]; ok {
+			return templatePart{name: name}, nil
+		}
+		return templatePart{}, fmt.Errorf("未知的占位符 {%s}", body)
+	}
+
+	maxLen, ok := placeholderMaxLen[name]
+	if !ok {
+		if knownPlaceholders[name] {
+			return templatePart{}, fmt.Errorf("占位符 {%s} 不支持长度参数", name)
+		}
+		return templatePart{}, fmt.Errorf("未知的占位符 {%s}", body)
+	}
+	length, err := strconv.Atoi(lengthStr)
+	if err != nil || length <= 0 {
+		return templatePart{}, fmt.Errorf("占位符 {%s} 的长度必须是正整数", body)
+	}
+	if maxLen > 0 && length > maxLen {
+		return templatePart{}, fmt.Errorf("占位符 {%s} 的长度不能超过 %d", body, maxLen)
+	}
+	return templatePart{name: name, length: length}, nil
+}
+
+// String 返回模板原文
+func (t *PathTemplate) String() string {
+	return t.raw
+}
+
+// NeedsSHA256 判断模板是否用到了 {sha256}，只有用到时才需要额外计算 SHA256
+func (t *PathTemplate) NeedsSHA256() bool {
+	for _, part := range t.parts {
+		if part.name == "sha256" {
+			return true
+		}
+	}
+	return false
+}
+
+// PathVars 是渲染远程路径模板所需的变量
+type PathVars struct {
+	User      string      // 用户名 (目录前缀)
+	Tag       string      // 配置标签名
+	LocalFile string      // 本地文件路径
+	RelPath   string      // 相对于输入根目录的路径 (使用 / 分隔)，为空时视为文件名
+	Time      time.Time   // 上传时间
+	Hashes    *FileHashes // 文件哈希
+}
+
+// Render 使用给定变量渲染远程路径，路径分隔符统一为 /，并去掉空的路径段
+func (t *PathTemplate) Render(vars PathVars) string {
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.name == "" {
+			b.WriteString(part.literal)
+			continue
+		}
+		b.WriteString(part.value(vars))
+	}
+
+	segments := strings.Split(strings.ReplaceAll(b.String(), "\\", "/"), "/")
+	cleaned := segments[:0]
+	for _, seg := range segments {
+		if seg != "" && seg != "." && seg != ".." {
+			cleaned = append(cleaned, seg)
+		}
+	}
+	return strings.Join(cleaned, "/")
+}
+
+// value 计算单个占位符的值
+func (p templatePart) value(vars PathVars) string {
+	base := filepath.Base(vars.LocalFile)
+	ext := GetFileExt(vars.LocalFile)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+
+	switch p.name {
+	case "user":
+		return vars.User
+	case "tag":
+		return vars.Tag
+	case "yyyy":
+		return vars.Time.Format("2006")
+	case "yy":
+		return vars.Time.Format("06")
+	case "mm":
+		return vars.Time.Format("01")
+	case "dd":
+		return vars.Time.Format("02")
+	case "hh":
+		return vars.Time.Format("15")
+	case "mi":
+		return vars.Time.Format("04")
+	case "ss":
+		return vars.Time.Format("05")
+	case "timestamp":
+		return strconv.FormatInt(vars.Time.Unix(), 10)
+	case "md5":
+		return truncate(vars.Hashes.MD5, p.length)
+	case "sha1":
+		return truncate(vars.Hashes.SHA1, p.length)
+	case "sha256":
+		return truncate(vars.Hashes.SHA256, p.length)
+	case "original_name":
+		return base
+	case "name":
+		return name
+	case "slug":
+		return Slugify(name)
+	case "ext":
+		return ext
+	case ".ext":
+		if ext == "" {
+			return ""
+		}
+		return "." + ext
+	case "dir":
+		return filepath.Base(filepath.Dir(vars.LocalFile))
+	case "relpath":
+		if vars.RelPath == "" {
+			return base
+		}
+		return vars.RelPath
+	case "reldir":
+		if dir := path.Dir(vars.RelPath); dir != "." {
+			return dir
+		}
+		return ""
+	case "uuid":
+		return randomUUID()
+	case "rand":
+		length := p.length
+		if length == 0 {
+			length = 8
+		}
+		return randomHex(length)
+	}
+	return ""
+}
+
+// truncate 截取字符串的前 n 位，n 为 0 时返回原字符串
+func truncate(s string, n int) string {
+	if n > 0 && n < len(s) {
+		return s[:n]
+	}
+	return s
+}
+
+// Slugify 将文件名规范化：字母转小写，连续的非字母数字字符替换为一个 -
+func Slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	slug := strings.TrimSuffix(b.String(), "-")
+	if slug == "" {
+		return "file"
+	}
+	return slug
+}
+
+// randomHex 生成指定长度的随机十六进制字符串
+func randomHex(n int) string {
+	buf := make([]byte, (n+1)/2)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)[:n]
+}
+
+// randomUUID 生成随机 UUID (v4)
+func randomUUID() string {
+	var buf [16]byte
+	_, _ = rand.Read(buf[:])
+	buf[6] = (buf[6] & 0x0f) | 0x40 // 版本 4
+	buf[8] = (buf[8] & 0x3f) | 0x80 // RFC 4122 变体
+	h := hex.EncodeToString(buf[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
@@ -0,0 +1,179 @@
+package util
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func testPathVars() PathVars {
+	return PathVars{
+		User:      "alice",
+		Tag:       "blog",
+		LocalFile: "/home/alice/photos/My Photo (1).PNG",
+		RelPath:   "trip/day1/My Photo (1).PNG",
+		Time:      time.Date(2025, 3, 7, 9, 5, 2, 0, time.UTC),
+		Hashes: &FileHashes{
+			Size:   3,
+			MD5:    "0123456789abcdef0123456789abcdef",
+			SHA1:   "aaaaaaaaaabbbbbbbbbbccccccccccdddddddddd",
+			SHA256: "0000000000111111111122222222223333333333444444444455555555556666",
+		},
+	}
+}
+
+func TestPathTemplateRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		modify   func(v *PathVars)
+		want     string
+	}{
+		{name: "default", template: DefaultPathTemplate, want: "alice/2025/0307/0123456789abcdef.PNG"},
+		{name: "user and tag", template: "{user}/{tag}/x", want: "alice/blog/x"},
+		{name: "time", template: "{yyyy}/{yy}/{mm}/{dd}/{hh}{mi}{ss}", want: "2025/25/03/07/090502"},
+		{name: "timestamp", template: "{timestamp}", want: strconv.FormatInt(time.Date(2025, 3, 7, 9, 5, 2, 0, time.UTC).Unix(), 10)},
+		{name: "full hashes", template: "{md5}-{sha1}-{sha256}", want: "0123456789abcdef0123456789abcdef-aaaaaaaaaabbbbbbbbbbccccccccccdddddddddd-0000000000111111111122222222223333333333444444444455555555556666"},
+		{name: "hash lengths", template: "{md5:16}/{sha1:8}/{sha256:4}", want: "0123456789abcdef/aaaaaaaa/0000"},
+		{name: "hash max length", template: "{md5:32}", want: "0123456789abcdef0123456789abcdef"},
+		{name: "original name", template: "{user}/{original_name}", want: "alice/My Photo (1).PNG"},
+		{name: "name and ext", template: "{name}.{ext}", want: "My Photo (1).PNG"},
+		{name: "dotted ext", template: "{slug}{.ext}", want: "my-photo-1.PNG"},
+		{name: "dir", template: "{dir}/{md5:8}", want: "photos/01234567"},
+		{name: "relpath", template: "{user}/{relpath}", want: "alice/trip/day1/My Photo (1).PNG"},
+		{name: "reldir", template: "{reldir}/{md5:8}{.ext}", want: "trip/day1/01234567.PNG"},
+		{name: "preserve paths", template: PreservePathsTemplate, want: "alice/trip/day1/My Photo (1).PNG"},
+		{
+			name:     "empty relpath falls back to file name",
+			template: "{user}/{relpath}",
+			modify:   func(v *PathVars) { v.RelPath = "" },
+			want:     "alice/My Photo (1).PNG",
+		},
+		{
+			name:     "empty reldir drops the segment",
+			template: "{user}/{reldir}/{name}",
+			modify:   func(v *PathVars) { v.RelPath = "My Photo (1).PNG" },
+			want:     "alice/My Photo (1)",
+		},
+		{
+			name:     "dot-dot segments removed",
+			template: "{user}/{relpath}",
+			modify:   func(v *PathVars) { v.RelPath = "../../etc/./passwd" },
+			want:     "alice/etc/passwd",
+		},
+		{
+			name:     "backslashes become slashes",
+			template: "{user}/{relpath}",
+			modify:   func(v *PathVars) { v.RelPath = `img\sub\a.png` },
+			want:     "alice/img/sub/a.png",
+		},
+		{
+			name:     "empty user leaves no leading slash",
+			template: "{user}/{original_name}",
+			modify:   func(v *PathVars) { v.User = "" },
+			want:     "My Photo (1).PNG",
+		},
+		{
+			name:     "no extension",
+			template: "{name}{.ext}|{ext}",
+			modify:   func(v *PathVars) { v.LocalFile = "/tmp/README" },
+			want:     "README|",
+		},
+		{name: "literal text", template: "static/{user}-img", want: "static/alice-img"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParsePathTemplate(tt.template)
+			if err != nil {
+				t.Fatalf("ParsePathTemplate(%q) 出错: %v", tt.template, err)
+			}
+			vars := testPathVars()
+			if tt.modify != nil {
+				tt.modify(&vars)
+			}
+			if got := tmpl.Render(vars); got != tt.want {
+				t.Errorf("Render(%q) = %q，期望 %q", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathTemplateRandom(t *testing.T) {
+	tests := []struct {
+		template string
+		pattern  string
+	}{
+		{"{uuid}", `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{"{rand}", `^[0-9a-f]{8}$`},
+		{"{rand:5}", `^[0-9a-f]{5}$`},
+		{"{rand:100}", `^[0-9a-f]{100}$`},
+	}
+	for _, tt := range tests {
+		tmpl, err := ParsePathTemplate(tt.template)
+		if err != nil {
+			t.Fatalf("ParsePathTemplate(%q) 出错: %v", tt.template, err)
+		}
+		if got := tmpl.Render(testPathVars()); !regexp.MustCompile(tt.pattern).MatchString(got) {
+			t.Errorf("Render(%q) = %q，不匹配 %s", tt.template, got, tt.pattern)
+		}
+	}
+}
+
+func TestParsePathTemplateInvalid(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"   ",
+		"/{user}/{md5}",
+		"{unknown}",
+		"{user}/{md5",
+		"{user}/md5}",
+		"a}{user}",
+		"{md5:0}",
+		"{md5:-1}",
+		"{md5:x}",
+		"{md5:33}",
+		"{sha1:41}",
+		"{sha256:65}",
+		"{user:3}",
+		"{relpath:10}",
+		"{}",
+	} {
+		if _, err := ParsePathTemplate(raw); err == nil {
+			t.Errorf("ParsePathTemplate(%q) 应当返回错误", raw)
+		}
+	}
+}
+
+func TestPathTemplateNeedsSHA256(t *testing.T) {
+	for raw, want := range map[string]bool{
+		DefaultPathTemplate:      false,
+		"{user}/{sha256}":        true,
+		"{user}/{sha256:16}.png": true,
+	} {
+		tmpl, err := ParsePathTemplate(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tmpl.NeedsSHA256(); got != want {
+			t.Errorf("NeedsSHA256(%q) = %v，期望 %v", raw, got, want)
+		}
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Hello World":   "hello-world",
+		"My Photo (1)":  "my-photo-1",
+		"__a__b__":      "a-b",
+		"!!!":           "file",
+		"":              "file",
+		"中文 名字":         "中文-名字",
+		"Café--Menu.v2": "café-menu-v2",
+	}
+	for in, want := range tests {
+		if got := Slugify(in); got != want {
+			t.Errorf("Slugify(%q) = %q，期望 %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayouts 是命令行时间参数支持的格式 (本地时区)
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// ParseTimeArg 解析 --since、--until 等命令行时间参数，支持：
+//
+//	2025-11-06、2025-11-06 15:04、RFC3339  绝对时间 (本地时区)
+//	30m、24h、7d、2w                       相对于当前时间之前
+//
+// endOfDay 为 true 时，只有日期的参数表示当天结束 (用于 --until 包含当天)
+func ParseTimeArg(s string, endOfDay bool) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if n := len(s); n > 1 && (s[n-1] == 'd' || s[n-1] == 'w') {
+		if count, err := strconv.Atoi(s[:n-1]); err == nil && count >= 0 {
+			days := count
+			if s[n-1] == 'w' {
+				days *= 7
+			}
+			return time.Now().AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	for _, layout := range timeLayouts {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err != nil {
+			continue
+		}
+		if layout == "2006-01-02" && endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("无法识别的时间 %q，可使用 2025-11-06、2025-11-06 15:04 或 7d、24h 等格式", s)
+}
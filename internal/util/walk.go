@@ -0,0 +1,195 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FindOptions 控制 FindFiles 查找文件的方式
+type FindOptions struct {
+	Recursive      bool     // 递归查找子目录中的文件
+	Include        []string // 只保留匹配任一模式的文件
+	Exclude        []string // 排除匹配任一模式的文件或目录
+	Hidden         bool     // 包含隐藏文件和目录 (名称以 . 开头)
+	FollowSymlinks bool     // 跟随符号链接，默认跳过
+}
+
+// finder 保存一次查找的状态
+type finder struct {
+	opts    FindOptions
+	pattern string // 含 ** 的模式相对于根目录的部分，为空表示不按模式过滤
+	ignores ignoreList
+	visited map[string]bool // 已进入的目录 (真实路径)，避免符号链接造成循环
+	files   []SourceFile
+	errs    []error
+}
+
+// FindFiles 根据给定的路径或模式查找文件
+// 支持文件名、文件夹名、通配符模式 (如 *.png) 和 ** 递归模式 (如 assets/**/*.png)。
+// 结果只包含普通文件：目录、设备文件等会被过滤，目录中的 .b2ignore 会按 gitignore 语法排除文件。
+// 部分子目录读取失败时，仍会返回已找到的文件以及错误
+func FindFiles(pathOrPattern string, opts FindOptions) ([]SourceFile, error) {
+	if pathOrPattern == "" {
+		return nil, fmt.Errorf("文件路径或模式不能为空")
+	}
+	f := &finder{opts: opts, visited: make(map[string]bool)}
+
+	// 1. 文件夹：查找其中的文件 (--recursive 时包括子目录)
+	if stat, err := os.Stat(pathOrPattern); err == nil && stat.IsDir() {
+		if err := f.ignores.load(pathOrPattern, ""); err != nil {
+			return nil, err
+		}
+		if err := f.walkDir(pathOrPattern, "", opts.Recursive); err != nil {
+			return nil, err
+		}
+		return f.files, errors.Join(f.errs...)
+	}
+
+	root := globRoot(pathOrPattern)
+	if err := f.ignores.load(root, ""); err != nil {
+		return nil, err
+	}
+
+	// 2. 含 ** 的模式：从通配符之前的目录开始递归查找，并用模式匹配相对路径
+	if strings.Contains(filepath.ToSlash(pathOrPattern), "**") {
+		rel, err := filepath.Rel(root, pathOrPattern)
+		if err != nil {
+			return nil, err
+		}
+		f.pattern = filepath.ToSlash(rel)
+		if err := f.walkDir(root, "", true); err != nil {
+			return nil, err
+		}
+		return f.files, errors.Join(f.errs...)
+	}
+
+	// 3. 文件名或普通通配符
+	matches, err := filepath.Glob(pathOrPattern)
+	if err != nil {
+		return nil, err
+	}
+	for _, match := range matches {
+		rel := relPath(root, match)
+		if !hasMeta(pathOrPattern) {
+			// 明确指定的文件不受隐藏文件和忽略规则的限制，但仍必须是普通文件
+			if stat, err := os.Stat(match); err == nil && stat.Mode().IsRegular() {
+				f.files = append(f.files, SourceFile{Path: match, Rel: rel})
+			}
+			continue
+		}
+		info, err := os.Lstat(match)
+		if err != nil {
+			f.errs = append(f.errs, err)
+			continue
+		}
+		f.visit(match, rel, info, opts.Recursive)
+	}
+	return f.files, errors.Join(f.errs...)
+}
+
+// walkDir 读取目录中的条目，recurse 为 true 时进入子目录
+func (f *finder) walkDir(dir, rel string, recurse bool) error {
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		if f.visited[real] {
+			return nil
+		}
+		f.visited[real] = true
+	}
+	if rel != "" {
+		if err := f.ignores.load(dir, rel); err != nil {
+			f.errs = append(f.errs, err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			f.errs = append(f.errs, err)
+			continue
+		}
+		f.visit(filepath.Join(dir, entry.Name()), path.Join(rel, entry.Name()), info, recurse)
+	}
+	return nil
+}
+
+// visit 处理单个条目：按规则过滤，目录在需要时递归进入，普通文件加入结果
+func (f *finder) visit(fullPath, rel string, info fs.FileInfo, recurse bool) {
+	if !f.opts.Hidden && strings.HasPrefix(info.Name(), ".") {
+		return
+	}
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if !f.opts.FollowSymlinks {
+			return
+		}
+		target, err := os.Stat(fullPath)
+		if err != nil {
+			f.errs = append(f.errs, err)
+			return
+		}
+		info = target
+	}
+
+	if info.IsDir() {
+		if !recurse || f.ignores.ignored(rel, true) || f.opts.excluded(rel) {
+			return
+		}
+		if err := f.walkDir(fullPath, rel, recurse); err != nil {
+			f.errs = append(f.errs, err)
+		}
+		return
+	}
+
+	if !info.Mode().IsRegular() || info.Name() == IgnoreFileName || f.ignores.ignored(rel, false) || f.opts.excluded(rel) || !f.opts.included(rel) {
+		return
+	}
+	if f.pattern != "" && !MatchPattern(f.pattern, rel) {
+		return
+	}
+	f.files = append(f.files, SourceFile{Path: fullPath, Rel: rel})
+}
+
+// Matches 判断单个文件的相对路径 (使用 / 分隔) 是否通过隐藏文件和 include/exclude 过滤，
+// 用于逐个判断新出现的文件 (例如 watch 模式)
+func (o FindOptions) Matches(rel string) bool {
+	if !o.Hidden {
+		for _, seg := range strings.Split(rel, "/") {
+			if strings.HasPrefix(seg, ".") {
+				return false
+			}
+		}
+	}
+	return !o.excluded(rel) && o.included(rel)
+}
+
+// excluded 判断相对路径是否匹配任一 --exclude 模式
+func (o FindOptions) excluded(rel string) bool {
+	for _, pattern := range o.Exclude {
+		if matchFilter(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// included 判断相对路径是否匹配任一 --include 模式，未设置 --include 时全部保留
+func (o FindOptions) included(rel string) bool {
+	if len(o.Include) == 0 {
+		return true
+	}
+	for _, pattern := range o.Include {
+		if matchFilter(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/xa1st/b2upload/internal/util"
+)
+
+// ProcessedFile 是一个已上传文件的记录
+type ProcessedFile struct {
+	Tag        string    `json:"tag"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"modTime"`
+	URL        string    `json:"url"`
+	UploadedAt time.Time `json:"uploadedAt"`
+}
+
+// Record 是保存在本地 JSON 文件中的已处理文件记录，避免 watch 重启后重复上传
+type Record struct {
+	path  string
+	mu    sync.Mutex
+	files map[string]*ProcessedFile // 本地文件绝对路径 -> 记录
+}
+
+// OpenRecord 打开 (或新建) 指定路径的记录文件
+func OpenRecord(path string) (*Record, error) {
+	r := &Record{path: path, files: make(map[string]*ProcessedFile)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+		return nil, fmt.Errorf("读取已处理文件记录失败: %w", err)
+	}
+	if len(data) == 0 {
+		return r, nil
+	}
+	if err := json.Unmarshal(data, &r.files); err != nil {
+		return nil, fmt.Errorf("解析已处理文件记录 %s 失败: %w", path, err)
+	}
+	return r, nil
+}
+
+// Path 返回记录文件路径
+func (r *Record) Path() string {
+	return r.path
+}
+
+// Processed 判断文件是否已经以当前的大小和修改时间上传过
+func (r *Record) Processed(absPath string, stat os.FileInfo) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.files[absPath]
+	return ok && f.Size == stat.Size() && f.ModTime.Equal(stat.ModTime())
+}
+
+// Add 记录一个已上传的文件并写入磁盘
+func (r *Record) Add(absPath string, f *ProcessedFile) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files[absPath] = f
+	data, err := json.MarshalIndent(r.files, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化已处理文件记录失败: %w", err)
+	}
+	if err := util.WriteFileAtomic(r.path, data); err != nil {
+		return fmt.Errorf("写入已处理文件记录失败: %w", err)
+	}
+	return nil
+}
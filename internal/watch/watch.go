@@ -0,0 +1,194 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultQuiet 是默认的防抖时间：文件在这段时间内没有新的写入才认为写入完成
+const DefaultQuiet = 2 * time.Second
+
+// Watcher 监视目录中新出现或被修改的文件。截图工具等程序通常分多次写入文件，
+// 因此每个文件在 Quiet 时间内没有新的事件且大小不再变化时才交给处理函数
+type Watcher struct {
+	Root      string        // 监视的目录
+	Recursive bool          // 同时监视子目录 (包括之后新建的子目录)
+	Quiet     time.Duration // 防抖时间
+	// Ignore 返回 true 的文件不会进入防抖队列，用于排除程序自身写入的记录文件等
+	Ignore func(path string) bool
+	Log    io.Writer // 监视出错时的警告输出
+
+	fsw     *fsnotify.Watcher
+	pending map[string]*pendingFile
+}
+
+// pendingFile 是等待写入完成的文件
+type pendingFile struct {
+	lastEvent time.Time
+	size      int64
+}
+
+// New 创建目录监视器
+func New(root string, recursive bool, quiet time.Duration) (*Watcher, error) {
+	stat, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("无法监视目录 %s: %w", root, err)
+	}
+	if !stat.IsDir() {
+		return nil, fmt.Errorf("%s 不是文件夹", root)
+	}
+	if quiet <= 0 {
+		quiet = DefaultQuiet
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("创建文件监视器失败: %w", err)
+	}
+	w := &Watcher{Root: root, Recursive: recursive, Quiet: quiet, Log: os.Stderr, fsw: fsw, pending: make(map[string]*pendingFile)}
+	if err := w.addDir(root); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// addDir 监视目录 (Recursive 时包括其中已有的子目录)，隐藏目录不会被监视
+func (w *Watcher) addDir(dir string) error {
+	if !w.Recursive {
+		return w.fsw.Add(dir)
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if err := w.fsw.Add(path); err != nil {
+			return fmt.Errorf("无法监视目录 %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// Run 开始监视，直到 ctx 被取消。写入完成的文件按顺序逐个交给 ready 处理，
+// 处理期间仍会继续接收文件事件；监视出错时只输出警告，继续监视
+func (w *Watcher) Run(ctx context.Context, ready func(path string)) {
+	defer w.fsw.Close()
+
+	queue := make(chan string, 256)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for path := range queue {
+			ready(path)
+		}
+	}()
+	defer func() {
+		close(queue)
+		<-done
+	}()
+
+	ticker := time.NewTicker(w.Quiet / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			w.handleEvent(event)
+
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w.Log, "警告: 文件监视出错: %v\n", err)
+
+		case now := <-ticker.C:
+			for _, path := range w.settled(now) {
+				select {
+				case queue <- path:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+// handleEvent 记录文件事件，新建的子目录在 Recursive 时加入监视
+func (w *Watcher) handleEvent(event fsnotify.Event) {
+	switch {
+	case event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename):
+		delete(w.pending, event.Name)
+
+	case event.Has(fsnotify.Create) || event.Has(fsnotify.Write):
+		stat, err := os.Stat(event.Name)
+		if err != nil {
+			return
+		}
+		if stat.IsDir() {
+			if w.Recursive && event.Has(fsnotify.Create) && !strings.HasPrefix(stat.Name(), ".") {
+				w.addDir(event.Name)
+				// 目录可能在加入监视前就已经写入了文件
+				filepath.WalkDir(event.Name, func(path string, d fs.DirEntry, err error) error {
+					if err != nil || !d.Type().IsRegular() {
+						return nil
+					}
+					if info, err := d.Info(); err == nil {
+						w.touch(path, info.Size())
+					}
+					return nil
+				})
+			}
+			return
+		}
+		if stat.Mode().IsRegular() {
+			w.touch(event.Name, stat.Size())
+		}
+	}
+}
+
+// touch 记录文件的最近一次事件时间和当时的大小，Ignore 排除的文件不会被记录
+func (w *Watcher) touch(path string, size int64) {
+	if w.Ignore != nil && w.Ignore(path) {
+		return
+	}
+	w.pending[path] = &pendingFile{lastEvent: time.Now(), size: size}
+}
+
+// settled 返回已在防抖时间内没有新事件且大小不再变化的文件
+func (w *Watcher) settled(now time.Time) []string {
+	var ready []string
+	for path, p := range w.pending {
+		if now.Sub(p.lastEvent) < w.Quiet {
+			continue
+		}
+		stat, err := os.Stat(path)
+		if err != nil || !stat.Mode().IsRegular() {
+			delete(w.pending, path)
+			continue
+		}
+		if stat.Size() != p.size {
+			// 大小仍在变化 (部分程序写入时不产生事件)，再等待一个防抖周期
+			p.size = stat.Size()
+			p.lastEvent = now
+			continue
+		}
+		delete(w.pending, path)
+		ready = append(ready, path)
+	}
+	return ready
+}
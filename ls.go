@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xa1st/b2upload/internal/b2"
+	"github.com/xa1st/b2upload/internal/util"
+)
+
+// lsCmd 列出标签下已上传的文件
+var lsCmd = &cobra.Command{
+	Use:   "ls <标签名> [前缀]",
+	Short: "列出已上传的文件",
+	Long: `ls 列出标签用户名目录 (用户名/) 下的文件，显示上传时间、大小、类型和公开 URL。
+前缀相对于用户名目录，例如 b2upload ls custom 2025/ 列出 用户名/2025/ 下的内容。
+默认只列出一层，子目录以 / 结尾显示；使用 --recursive 列出所有子目录中的文件。`,
+	Args: cobra.RangeArgs(1, 2),
+	Run:  runLs,
+}
+
+var (
+	lsRecursive bool
+	lsSince     string
+	lsUntil     string
+	lsLimit     int
+)
+
+func init() {
+	lsCmd.Flags().BoolVarP(&lsRecursive, "recursive", "r", false, "列出所有子目录中的文件")
+	lsCmd.Flags().StringVar(&lsSince, "since", "", "只显示该时间之后上传的文件，如 2025-11-01 或 7d")
+	lsCmd.Flags().StringVar(&lsUntil, "until", "", "只显示该时间之前上传的文件 (只有日期时包含当天)")
+	lsCmd.Flags().IntVarP(&lsLimit, "limit", "n", 0, "最多显示多少个条目 (0 表示全部)")
+	lsCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "输出格式：text、json 或 ndjson")
+	rootCmd.AddCommand(lsCmd)
+}
+
+// lsRecord 是 ls 在 JSON 输出中的一个条目
+type lsRecord struct {
+	Name        string            `json:"name"`
+	Folder      bool              `json:"folder,omitempty"`
+	URL         string            `json:"url,omitempty"`
+	Size        int64             `json:"size,omitempty"`
+	ContentType string            `json:"contentType,omitempty"`
+	UploadTime  *time.Time        `json:"uploadTime,omitempty"`
+	FileID      string            `json:"fileId,omitempty"`
+	SHA1        string            `json:"sha1,omitempty"`
+	FileInfo    map[string]string `json:"fileInfo,omitempty"`
+}
+
+// runLs 分页列出文件，按时间过滤后输出
+func runLs(cmd *cobra.Command, args []string) {
+	if err := validateOutputFormat(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	since, err := util.ParseTimeArg(lsSince, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: --since: %v\n", err)
+		os.Exit(1)
+	}
+	until, err := util.ParseTimeArg(lsUntil, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: --until: %v\n", err)
+		os.Exit(1)
+	}
+
+	tagName := args[0]
+	uploader, err := authorizedUploader(tagName, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	uploader.Log = logOut()
+
+	prefix := userPrefix(uploader, args[1:])
+	delimiter := ""
+	if !lsRecursive {
+		delimiter = "/"
+	}
+
+	var records []lsRecord
+	var totalSize int64
+	startFileName := ""
+	for {
+		page, err := uploader.ListFileNames(prefix, delimiter, startFileName, b2.MaxListPageSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 列出文件失败: %v\n", err)
+			os.Exit(1)
+		}
+		for _, f := range page.Files {
+			record, ok := newLsRecord(uploader, f, since, until)
+			if !ok {
+				continue
+			}
+			records = append(records, record)
+			totalSize += record.Size
+			if outputFormat == outputNDJSON {
+				json.NewEncoder(os.Stdout).Encode(record)
+			}
+			if lsLimit > 0 && len(records) >= lsLimit {
+				break
+			}
+		}
+		if page.NextFileName == "" || (lsLimit > 0 && len(records) >= lsLimit) {
+			break
+		}
+		startFileName = page.NextFileName
+	}
+
+	switch outputFormat {
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if records == nil {
+			records = []lsRecord{}
+		}
+		enc.Encode(records)
+	case outputText:
+		for _, r := range records {
+			if r.Folder {
+				fmt.Printf("%-16s  %10s  %-24s  %s\n", "", "目录", "", r.Name)
+				continue
+			}
+			fmt.Printf("%-16s  %10s  %-24s  %s\n", r.UploadTime.Format("2006-01-02 15:04"), util.FormatSize(r.Size), r.ContentType, r.URL)
+		}
+	}
+	fmt.Fprintf(logOut(), "%s 下共 %d 个条目，总大小 %s\n", prefix, len(records), util.FormatSize(totalSize))
+}
+
+// userPrefix 将命令行中的前缀转换为 B2 中的完整前缀，限定在标签的用户名目录下
+func userPrefix(uploader *b2.Uploader, args []string) string {
+	base := uploader.Config.User + "/"
+	prefix := base
+	if len(args) == 1 {
+		rel := strings.TrimPrefix(args[0], "/")
+		rel = strings.TrimPrefix(rel, base)
+		prefix = base + rel
+	}
+	// 按目录浏览时，前缀必须以 / 结尾才能列出目录中的内容
+	if !lsRecursive && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix
+}
+
+// newLsRecord 将 B2 返回的文件信息转换为输出条目，不在时间范围内的文件返回 false
+func newLsRecord(uploader *b2.Uploader, f b2.UploadFileResponse, since, until time.Time) (lsRecord, bool) {
+	if f.Action == "folder" {
+		// 目录没有时间信息，只在未按时间过滤时显示
+		return lsRecord{Name: f.FileName, Folder: true}, since.IsZero() && until.IsZero()
+	}
+	uploaded := time.UnixMilli(f.UploadTimestamp)
+	if (!since.IsZero() && uploaded.Before(since)) || (!until.IsZero() && !uploaded.Before(until)) {
+		return lsRecord{}, false
+	}
+	return lsRecord{
+		Name:        f.FileName,
+		URL:         uploader.PublicURL(f.FileName),
+		Size:        f.ContentLength,
+		ContentType: f.ContentType,
+		UploadTime:  &uploaded,
+		FileID:      f.FileID,
+		SHA1:        f.SHA1(),
+		FileInfo:    f.FileInfo,
+	}, true
+}
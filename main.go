@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"github.com/xa1st/b2upload/internal/b2"
 	"github.com/xa1st/b2upload/internal/config"
@@ -22,144 +25,383 @@ var rootCmd = &cobra.Command{
 	Short:   "Backblaze B2 图床上传工具",
 	Long:    `b2upload 是一个命令行工具，用于上传文件到 Backblaze B2 图床。标签名 (如 custom) 和至少一个文件/文件夹路径都必须提供。`,
 	Version: version,
-	Run:     runUpload,
+	Args:    cobra.ArbitraryArgs, // 存在子命令时，仍允许第一个参数为标签名
 }
 
-// initConfig 是 Viper 初始化的关键函数，负责读取和合并配置
-func initConfig() {
-	// 1. 设置配置文件的搜索路径和名称
-	viper.SetConfigName("b2upload") // 配置文件名应为 b2upload.toml
-	viper.SetConfigType("toml")
+// configFile 是 --config 指定的配置文件路径，为空时按 configSearchPaths 的顺序查找
+var configFile string
+
+// configErr 是读取 --config 指定的配置文件失败的原因，在需要使用配置时报告 (config init 除外)
+var configErr error
+
+// systemConfigDir 是系统级配置文件所在的目录 (非 Windows)
+const systemConfigDir = "/etc/b2upload"
 
-	// 搜索路径 : 可执行文件所在的目录 (适用于编译后的 EXE)
+// configSearchPaths 返回查找 b2upload.toml (或 .yaml、.yml、.json) 的目录，按优先级排列：
+// $XDG_CONFIG_HOME/b2upload、用户配置目录、~/.config/b2upload、当前工作目录、可执行文件所在目录、/etc/b2upload。
+// 用户目录优先于当前工作目录，避免任意目录中的配置文件 (可设置 api_url) 接管用户的凭据
+func configSearchPaths() []string {
+	var dirs []string
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		dirs = append(dirs, filepath.Join(xdg, "b2upload"))
+	}
+	// Windows 为 %AppData%，macOS 为 ~/Library/Application Support
+	if dir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "b2upload"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".config", "b2upload"))
+	}
+	if wd, err := os.Getwd(); err == nil {
+		dirs = append(dirs, wd)
+	}
+	// 可执行文件所在的目录 (适用于编译后的 EXE，与旧版本兼容)
 	if ex, err := os.Executable(); err == nil {
-		exePath := filepath.Dir(ex)
-		viper.AddConfigPath(exePath)
+		dirs = append(dirs, filepath.Dir(ex))
+	}
+	if runtime.GOOS != "windows" {
+		dirs = append(dirs, systemConfigDir)
+	}
+
+	// 去掉重复的目录，保留第一次出现的位置
+	seen := make(map[string]bool)
+	unique := dirs[:0]
+	for _, dir := range dirs {
+		if !seen[dir] {
+			seen[dir] = true
+			unique = append(unique, dir)
+		}
+	}
+	return unique
+}
+
+// initConfig 是 Viper 初始化的关键函数，负责读取和合并配置
+func initConfig() {
+	// 1. 设置配置文件的路径：--config 或 B2UPLOAD_CONFIG 指定的文件，否则按顺序在各目录中查找
+	if configFile == "" {
+		configFile = os.Getenv("B2UPLOAD_CONFIG")
+	}
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+	} else {
+		// 不设置配置类型，按扩展名支持 b2upload.toml、b2upload.yaml、b2upload.json 等
+		viper.SetConfigName("b2upload")
+		for _, dir := range configSearchPaths() {
+			viper.AddConfigPath(dir)
+		}
 	}
 
 	// 2. 读取配置文件
 	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+		if configFile != "" {
+			// 明确指定的配置文件必须能够读取
+			configErr = fmt.Errorf("错误: 读取配置文件 %s 失败: %w", configFile, err)
+		} else if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
 			// 只有不是“文件未找到”的错误才打印警告
 			fmt.Fprintf(os.Stderr, "警告: 读取配置文件失败: %v\n", err)
 		}
 	}
+	// 环境变量覆盖配置文件：配置项 tags.custom.url 对应 B2UPLOAD_TAGS_CUSTOM_URL (. 和 - 替换为 _)
+	viper.SetEnvPrefix("B2UPLOAD")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	viper.AutomaticEnv()
 	// 3. 设置默认值 (仅设置全局项)
 	// 确保这里使用 baseurl (而不是 base_url)，以匹配你的 TOML 文件
 	viper.SetDefault("baseurl", "https://f000.backblazeb2.com/file")
+	// 大文件分片上传参数 (单位 MB)
+	viper.SetDefault("large_file_threshold", config.DefaultLargeFileThresholdMB)
+	viper.SetDefault("part_size", config.DefaultPartSizeMB)
+	viper.SetDefault("part_concurrency", config.DefaultPartConcurrency)
+	// 上传历史默认开启
+	viper.SetDefault("history", true)
+	// 请求重试参数
+	viper.SetDefault("retry.max_retries", config.DefaultMaxRetries)
+	viper.SetDefault("retry.base_delay", config.DefaultRetryBaseDelay)
+	viper.SetDefault("retry.max_delay", config.DefaultRetryMaxDelay)
+
+	// 4. 与子命令同名的标签会被当作子命令执行，在这里提示，避免 b2upload ls a.png 之类的命令报出难以理解的错误
+	for name := range viper.GetStringMap("tags") {
+		if cmdName := conflictingCommand(name); cmdName != "" {
+			fmt.Fprintf(os.Stderr, "警告: %v\n", strings.TrimPrefix(tagConflictError(name, cmdName).Error(), "错误: "))
+		}
+	}
+}
+
+// tagFlags 是可以覆盖标签配置的全局命令行参数名称 -> 标签下的配置项
+var tagFlags = map[string]string{
+	"token":  "token",
+	"bucket": "bucket",
+	"user":   "username",
+	"url":    "url",
 }
 
+// globalFlags 是对所有子命令生效的全局参数 (--token 等)，在 init 中加入根命令
+var globalFlags = pflag.NewFlagSet("global", pflag.ContinueOnError)
+
+// preservePaths 为 true 时按输入目录结构生成远程路径 (--preserve-paths)
+var preservePaths bool
+
+// findOpts 是查找本地文件的选项 (--recursive、--include、--exclude 等)
+var findOpts util.FindOptions
+
 func init() {
 	// Cobra 支持多个根命令，但此处只有一个
+	// runUpload 通过 conflictingCommand 间接引用 rootCmd，不能在 rootCmd 的初始化表达式中设置
+	rootCmd.Run = runUpload
 	cobra.OnInitialize(initConfig)
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "配置文件路径 (支持 toml、yaml、json)，也可通过环境变量 B2UPLOAD_CONFIG 指定")
+	// 全局参数，对所有子命令生效，优先于环境变量和配置文件
+	globalFlags.String("token", "", "B2 Key ID:Application Key，覆盖配置中的 token")
+	globalFlags.String("bucket", "", "B2 Bucket 名称，覆盖配置中的 bucket")
+	globalFlags.String("user", "", "用户名 (远程目录)，覆盖标签的 username")
+	globalFlags.String("url", "", "公开访问域名，覆盖标签的 url")
+	rootCmd.PersistentFlags().AddFlagSet(globalFlags)
+	rootCmd.Flags().BoolVar(&preservePaths, "preserve-paths", false, "保留目录结构：远程路径为 用户名/相对于输入目录的路径 (忽略 path_template)")
+	rootCmd.Flags().BoolVarP(&findOpts.Recursive, "recursive", "r", false, "递归上传文件夹中所有子目录的文件")
+	rootCmd.Flags().StringArrayVar(&findOpts.Include, "include", nil, "只上传匹配该模式的文件，可多次指定 (如 --include '*.png')")
+	rootCmd.Flags().StringArrayVar(&findOpts.Exclude, "exclude", nil, "排除匹配该模式的文件或目录，可多次指定 (如 --exclude 'tmp/**')")
+	rootCmd.Flags().BoolVar(&findOpts.Hidden, "hidden", false, "包含隐藏文件和目录 (名称以 . 开头)")
+	rootCmd.Flags().BoolVar(&findOpts.FollowSymlinks, "follow-symlinks", false, "跟随符号链接 (默认跳过)")
+	rootCmd.Flags().StringVarP(&linkFormat, "format", "f", "", "按格式输出链接：markdown、html、bbcode、rst、url 或 template (可在标签中设置 format 作为默认值)")
+	rootCmd.Flags().StringVar(&linkTemplate, "template", "", "自定义链接模板 (Go text/template)，例如 '![{{.Name}}]({{.URL}})'，指定后默认使用 template 格式")
+	rootCmd.Flags().BoolVar(&typoraMode, "typora", false, "Typora / PicGo 兼容模式：标准输出为 Upload Success: 及按输入顺序排列的 URL，任一文件失败时返回非 0")
+	rootCmd.Flags().BoolVar(&typoraMode, "picgo", false, "同 --typora")
+	rootCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "结果输出格式：text、json 或 ndjson (json/ndjson 模式下提示信息输出到标准错误)")
 	// 显示版本信息
 	rootCmd.SetVersionTemplate("b2upload v{{.Version}}\n")
 }
 
-// runUpload 是实际执行文件上传逻辑的函数
-func runUpload(cmd *cobra.Command, args []string) {
-	// 检查参数数量：至少需要 2 个参数 (tag名 + 1个文件/文件夹)
-	if len(args) < 2 { // 移除 && len(args) != 0，因为 len(args)=0 会被 Help() 捕获或不满足 len(args)<2
-		if len(args) == 0 {
-			cmd.Help() // 如果没有参数，显示帮助
-			return
+// appDir 返回存放配置文件及本地数据文件的目录：优先使用已加载配置文件所在目录，否则使用可执行文件所在目录。
+// 系统级配置目录通常不可写，此时使用用户配置目录
+func appDir() string {
+	if used := viper.ConfigFileUsed(); used != "" {
+		dir := filepath.Dir(used)
+		if dir != systemConfigDir {
+			return dir
 		}
-		fmt.Fprintln(os.Stderr, "错误: 必须提供标签名和至少一个文件/文件夹路径。")
-		cmd.Help()
-		return
+		if userDir, err := os.UserConfigDir(); err == nil {
+			dir = filepath.Join(userDir, "b2upload")
+			if err := os.MkdirAll(dir, 0o755); err == nil {
+				return dir
+			}
+		}
+	}
+	if ex, err := os.Executable(); err == nil {
+		return filepath.Dir(ex)
+	}
+	return "."
+}
+
+// stateFilePath 返回记录大文件上传进度的状态文件路径 (可通过 state_file 配置项指定)
+func stateFilePath() string {
+	if path := viper.GetString("state_file"); path != "" {
+		return path
 	}
+	return filepath.Join(appDir(), "b2upload.state.json")
+}
 
-	// 1. **标签解析和配置提取**
-	tagName := args[0]       // 标签名现在是第一个位置参数
-	filePatterns := args[1:] // 文件/文件夹路径是 args 剩余的部分
+// openStateStore 打开记录大文件上传进度的状态文件
+func openStateStore() (*b2.StateStore, error) {
+	return b2.OpenStateStore(stateFilePath())
+}
 
-	// 获取开始时间
-	startTime := time.Now()
+// bindTagFlags 将 --token、--bucket、--user、--url 绑定到指定标签的配置项，
+// 使命令行参数优先于标签和根部的配置 (命令行参数 > 环境变量 > 配置文件 > 默认值)
+func bindTagFlags(tagName string) {
+	for flag, key := range tagFlags {
+		viper.BindPFlag("tags."+tagName+"."+key, globalFlags.Lookup(flag))
+	}
+}
 
-	// 从配置文件根部获取 B2 认证和基础 URL
-	token := viper.GetString("token")
-	bucket := viper.GetString("bucket")
-	baseUrl := viper.GetString("baseurl") // 读取 baseurl
+// envToken 返回环境变量中的 token：B2UPLOAD_TOKEN 优先，
+// 其次为 B2 官方工具的环境变量 B2_APPLICATION_KEY_ID 和 B2_APPLICATION_KEY，都未设置时返回空字符串
+func envToken() string {
+	if token := os.Getenv("B2UPLOAD_TOKEN"); token != "" {
+		return token
+	}
+	keyID, key := os.Getenv("B2_APPLICATION_KEY_ID"), os.Getenv("B2_APPLICATION_KEY")
+	if keyID != "" && key != "" {
+		return keyID + ":" + key
+	}
+	return ""
+}
 
+// rootToken 返回配置根部的 token，环境变量优先于配置文件
+func rootToken() string {
+	return firstNonEmpty(envToken(), viper.GetString("token"))
+}
+
+// tagToken 返回标签使用的 token，优先级为：--token > 环境变量 (B2UPLOAD_TAGS_<标签>_TOKEN、B2UPLOAD_TOKEN、
+// B2_APPLICATION_KEY_ID/B2_APPLICATION_KEY) > 配置文件中标签的 token > 配置文件根部的 token
+func tagToken(tagName string) string {
+	if flag := globalFlags.Lookup("token"); flag.Changed {
+		return flag.Value.String()
+	}
+	tagEnv := "B2UPLOAD_TAGS_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(tagName)) + "_TOKEN"
+	if token := firstNonEmpty(os.Getenv(tagEnv), envToken()); token != "" {
+		return token
+	}
+	return firstNonEmpty(viper.GetString("tags."+tagName+".token"), viper.GetString("token"))
+}
+
+// tagSetting 读取标签下的配置项，标签未设置时回退到配置文件根部的同名配置项
+func tagSetting(tagName, key string) string {
+	if value := viper.GetString("tags." + tagName + "." + key); value != "" {
+		return value
+	}
+	return viper.GetString(key)
+}
+
+// loadTagConfig 读取指定标签的配置，合并全局配置后构造 config.Config
+func loadTagConfig(tagName string) (*config.Config, error) {
+	if configErr != nil {
+		return nil, configErr
+	}
+	if cmdName := conflictingCommand(tagName); cmdName != "" {
+		return nil, tagConflictError(tagName, cmdName)
+	}
 	// 查找标签配置 (使用 [tags.XXX] 结构)
+	bindTagFlags(tagName)
 	tagKey := fmt.Sprintf("tags.%s", tagName) // 构造 Viper 路径：例如 "tags.mdd"
 	user := viper.GetString(tagKey + ".username")
-	tagUrl := viper.GetString(tagKey + ".url") // 读取标签下的 URL
-	// 调试信息，在生产环境中可移除
-	// fmt.Println(tagKey, user, tagUrl)
+
+	// B2 认证、Bucket 和 API 地址：标签下的配置优先，其次为配置文件根部的配置 (不同标签可以使用不同的 B2 账户)；
+	// token 另外要保证环境变量优先于配置文件中标签的 token，见 tagToken
+	token := tagToken(tagName)
+	bucket := tagSetting(tagName, "bucket")
+	apiURL := tagSetting(tagName, "api_url")
 
 	// ***** 核心回退逻辑 (使用标签 URL 或 baseurl) *****
-	finalUrl := tagUrl
+	finalUrl := viper.GetString(tagKey + ".url")
 	if finalUrl == "" {
-		finalUrl = baseUrl // 回退到全局 baseurl
+		finalUrl = tagSetting(tagName, "baseurl") // 回退到标签或全局 baseurl
 	}
 	// ************************
 
 	// 检查标签配置是否完整
 	if user == "" {
-		// 打印清晰的错误信息，引导用户检查 TOML 文件
-		fmt.Fprintf(os.Stderr, "错误: 未能找到或解析配置标签 [%s]。请检查 b2upload.toml 文件中 [%s] 部分的 username 字段是否存在。\n", tagName, tagKey)
+		// 返回清晰的错误信息，引导用户检查 TOML 文件
+		return nil, fmt.Errorf("错误: 未能找到或解析配置标签 [%s]。请检查 b2upload.toml 文件中 [%s] 部分的 username 字段是否存在。", tagName, tagKey)
+	}
+
+	cfg, err := config.NewConfig(tagName, user, finalUrl, token, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.SetAPIURL(apiURL); err != nil {
+		return nil, err
+	}
+	// 路径模板：标签下的 path_template 优先，其次为全局 path_template
+	if err := cfg.SetPathTemplate(tagSetting(tagName, "path_template")); err != nil {
+		return nil, err
+	}
+	err = cfg.SetLargeFileOptions(viper.GetInt64("large_file_threshold"), viper.GetInt64("part_size"), viper.GetInt("part_concurrency"))
+	if err != nil {
+		return nil, err
+	}
+	err = cfg.SetRetryOptions(viper.GetInt("retry.max_retries"), viper.GetDuration("retry.base_delay"), viper.GetDuration("retry.max_delay"))
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// runUpload 是实际执行文件上传逻辑的函数
+func runUpload(cmd *cobra.Command, args []string) {
+	// 检查参数数量：至少需要 2 个参数 (tag名 + 1个文件/文件夹)
+	if len(args) < 2 { // 移除 && len(args) != 0，因为 len(args)=0 会被 Help() 捕获或不满足 len(args)<2
+		if len(args) == 0 {
+			cmd.Help() // 如果没有参数，显示帮助
+			return
+		}
+		fmt.Fprintln(os.Stderr, "错误: 必须提供标签名和至少一个文件/文件夹路径。")
+		cmd.Help()
+		return
+	}
+
+	if err := validateOutputFormat(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 
-	fmt.Printf("正在使用配置标签: [%s] (用户: %s, URL: %s)\n", tagName, user, finalUrl)
+	// 1. **标签解析和配置提取**
+	tagName := args[0]       // 标签名现在是第一个位置参数
+	filePatterns := args[1:] // 文件/文件夹路径是 args 剩余的部分
+
+	// 获取开始时间
+	startTime := time.Now()
 
 	// 2. 加载配置
-	cfg, err := config.NewConfig(user, finalUrl, token, bucket)
+	cfg, err := loadTagConfig(tagName)
 	if err != nil {
-		fmt.Println(err.Error())
+		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 
+	if preservePaths {
+		cfg.SetPreservePaths()
+	}
+	// Typora 模式只输出 URL，忽略标签中配置的默认链接格式
+	if !typoraMode {
+		if linkRenderer, err = loadLinkRenderer(tagName); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	fmt.Fprintf(logOut(), "正在使用配置标签: [%s] (用户: %s, Bucket: %s, URL: %s)\n", tagName, cfg.User, cfg.Bucket, cfg.URL)
+
 	// ----------------------------------------------------------------------------------
 	// 3. 【优化】查找文件 (处理所有参数) - 提前到授权前
-	var filesToUpload []string
+	var filesToUpload []util.SourceFile
 	// 循环使用 filePatterns (即 args[1:])
 	for _, pattern := range filePatterns {
-		files, err := util.FindFiles(pattern)
+		files, err := util.FindFiles(pattern, findOpts)
 		if err != nil {
+			// 部分子目录读取失败时，仍上传已找到的文件
 			fmt.Fprintf(os.Stderr, "警告: 查找文件模式 %s 失败: %v\n", pattern, err)
-			continue
 		}
 		filesToUpload = append(filesToUpload, files...)
 	}
 
 	if len(filesToUpload) == 0 {
 		// 如果未找到文件，提前退出，避免 B2 授权 (网络连接)
-		fmt.Println("未找到任何文件进行上传。")
+		fmt.Fprintln(logOut(), "未找到任何文件进行上传。")
+		if typoraMode {
+			os.Exit(1)
+		}
+		if outputFormat != outputText {
+			reportResults(tagName, nil, time.Since(startTime))
+		}
 		return
 	}
 
-	fmt.Printf("当前目录中共找到 %d 个文件，开始并发上传...\n", len(filesToUpload))
+	fmt.Fprintf(logOut(), "当前目录中共找到 %d 个文件，开始并发上传...\n", len(filesToUpload))
 	// ----------------------------------------------------------------------------------
 
 	// 4. 【网络操作】初始化上传器并进行 B2 授权 - 仅在确定有文件后执行
 	uploader := b2.NewUploader(cfg)
+	uploader.Log = logOut()
+	if uploader.State, err = openStateStore(); err != nil {
+		fmt.Fprintf(logOut(), "警告: %v，本次上传不支持断点续传\n", err)
+	}
 	if err := uploader.AuthorizeAccount(); err != nil {
-		fmt.Printf("B2 账户授权失败: %v\n", err)
+		fmt.Fprintf(os.Stderr, "B2 账户授权失败: %v\n", err)
 		os.Exit(1)
 	}
 
 	// 5. 执行并发上传
 	results := uploader.UploadFiles(filesToUpload)
 
-	// 6. 打印结果和总结
-	successCount := 0
-	for _, res := range results {
-		if res.Error != nil {
-			fmt.Printf("上传失败，原文件是：%s，错误信息：%v\n", filepath.Base(res.LocalFile), res.Error)
-		} else {
-			fmt.Printf("上传成功，原文件是：%s 远程路径文件：%s\n", filepath.Base(res.LocalFile), res.PublicURL)
-			successCount++
+	// 6. 记录上传历史，打印结果和总结
+	recordHistory(tagName, results)
+	if typoraMode {
+		if !reportTypora(results) {
+			os.Exit(1)
 		}
+		return
 	}
-
-	duration := time.Since(startTime).Seconds()
-	if successCount == len(filesToUpload) {
-		fmt.Printf("全部 %d 个文件上传成功，本次用时 %.2f 秒\n", successCount, duration)
-	} else {
-		fmt.Printf("上传完成。成功 %d 个，失败 %d 个，本次用时 %.2f 秒\n", successCount, len(filesToUpload)-successCount, duration)
-	}
+	reportResults(tagName, results, time.Since(startTime))
 }
 
 func main() {
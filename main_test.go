@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestTagToken(t *testing.T) {
+	tests := []struct {
+		name string
+		flag string
+		env  map[string]string
+		file map[string]string
+		want string
+	}{
+		{name: "root file", file: map[string]string{"token": "root:file"}, want: "root:file"},
+		{name: "tag file over root file", file: map[string]string{"token": "root:file", "tags.ci.token": "tag:file"}, want: "tag:file"},
+		{name: "B2UPLOAD_TOKEN over tag file", env: map[string]string{"B2UPLOAD_TOKEN": "env:token"}, file: map[string]string{"tags.ci.token": "tag:file"}, want: "env:token"},
+		{name: "B2 key env over tag file", env: map[string]string{"B2_APPLICATION_KEY_ID": "id", "B2_APPLICATION_KEY": "key"}, file: map[string]string{"tags.ci.token": "tag:file"}, want: "id:key"},
+		{name: "B2 key env missing key", env: map[string]string{"B2_APPLICATION_KEY_ID": "id"}, file: map[string]string{"tags.ci.token": "tag:file"}, want: "tag:file"},
+		{name: "B2UPLOAD_TOKEN over B2 key env", env: map[string]string{"B2UPLOAD_TOKEN": "env:token", "B2_APPLICATION_KEY_ID": "id", "B2_APPLICATION_KEY": "key"}, want: "env:token"},
+		{name: "tag env over B2UPLOAD_TOKEN", env: map[string]string{"B2UPLOAD_TAGS_CI_TOKEN": "tag:env", "B2UPLOAD_TOKEN": "env:token"}, want: "tag:env"},
+		{name: "flag over everything", flag: "flag:token", env: map[string]string{"B2UPLOAD_TAGS_CI_TOKEN": "tag:env", "B2UPLOAD_TOKEN": "env:token"}, file: map[string]string{"tags.ci.token": "tag:file"}, want: "flag:token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"B2UPLOAD_TAGS_CI_TOKEN", "B2UPLOAD_TOKEN", "B2_APPLICATION_KEY_ID", "B2_APPLICATION_KEY"} {
+				t.Setenv(key, tt.env[key])
+			}
+			viper.Reset()
+			t.Cleanup(viper.Reset)
+			for key, value := range tt.file {
+				viper.Set(key, value)
+			}
+			flag := globalFlags.Lookup("token")
+			if tt.flag != "" {
+				globalFlags.Set("token", tt.flag)
+				t.Cleanup(func() {
+					flag.Value.Set("")
+					flag.Changed = false
+				})
+			}
+			if got := tagToken("ci"); got != tt.want {
+				t.Errorf("tagToken = %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConflictingCommand(t *testing.T) {
+	for name, want := range map[string]string{
+		"custom":     "",
+		"ls":         "ls",
+		"LS":         "ls",
+		"sync":       "sync",
+		"help":       "help",
+		"completion": "completion",
+		"lsx":        "",
+	} {
+		if got := conflictingCommand(name); got != want {
+			t.Errorf("conflictingCommand(%q) = %q，期望 %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/xa1st/b2upload/internal/b2"
+	"github.com/xa1st/b2upload/internal/format"
+)
+
+// 支持的 --output 输出格式
+const (
+	outputText   = "text"   // 面向人阅读的中文提示 (默认)
+	outputJSON   = "json"   // 一个 JSON 对象，包含所有结果和汇总
+	outputNDJSON = "ndjson" // 每行一个 JSON 对象：每个文件一行，最后一行为汇总
+)
+
+// outputFormat 是 --output 指定的结果输出格式
+var outputFormat = outputText
+
+// linkFormat 和 linkTemplate 是 --format 和 --template 指定的链接格式
+var linkFormat, linkTemplate string
+
+// linkRenderer 是本次上传使用的链接渲染器，未指定链接格式时为 nil
+var linkRenderer *format.Renderer
+
+// loadLinkRenderer 按 命令行参数 > 标签配置 > 全局配置 的顺序确定链接格式和模板，均未设置时返回 nil
+func loadLinkRenderer(tagName string) (*format.Renderer, error) {
+	tagKey := "tags." + tagName
+	kind := firstNonEmpty(linkFormat, viper.GetString(tagKey+".format"), viper.GetString("format"))
+	tmpl := firstNonEmpty(linkTemplate, viper.GetString(tagKey+".template"), viper.GetString("template"))
+	if kind == "" && tmpl == "" {
+		return nil, nil
+	}
+	renderer, err := format.NewRenderer(kind, tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("错误: 标签 [%s] 的链接格式配置无效: %w", tagName, err)
+	}
+	return renderer, nil
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// renderLink 按链接格式渲染成功上传的文件，渲染失败时返回 URL 并在提示信息中给出警告
+func renderLink(res b2.UploadResult) string {
+	link := format.NewLink(res.LocalFile, res.RemotePath, res.PublicURL, res.ContentType, res.Size, res.MD5, res.SHA1, res.Skipped)
+	text, err := linkRenderer.Render(link)
+	if err != nil {
+		fmt.Fprintf(logOut(), "警告: %s: %v\n", filepath.Base(res.LocalFile), err)
+		return res.PublicURL
+	}
+	return text
+}
+
+// typoraMode 为 true 时按 Typora / PicGo 自定义上传命令的约定输出 (--typora / --picgo)
+var typoraMode bool
+
+// validateOutputFormat 检查 --output 的取值
+func validateOutputFormat() error {
+	if typoraMode && (outputFormat != outputText || linkFormat != "" || linkTemplate != "") {
+		return fmt.Errorf("错误: --typora 模式只输出 URL，不能与 --output、--format 或 --template 同时使用")
+	}
+	switch outputFormat {
+	case outputText, outputJSON, outputNDJSON:
+		return nil
+	}
+	return fmt.Errorf("错误: 不支持的输出格式 %q，可选值为 text、json、ndjson", outputFormat)
+}
+
+// logOut 返回提示信息的输出位置：机器可读模式或输出链接时写到标准错误，保证标准输出只包含结果数据
+func logOut() io.Writer {
+	if outputFormat == outputText && linkRenderer == nil && !typoraMode {
+		return os.Stdout
+	}
+	return os.Stderr
+}
+
+// errorRecord 是 JSON 输出中的错误信息
+type errorRecord struct {
+	Code    string `json:"code"`    // 错误码，见 b2.ErrorCode
+	Message string `json:"message"` // 错误描述
+}
+
+// resultRecord 是 JSON 输出中单个文件的上传结果
+type resultRecord struct {
+	Type        string       `json:"type,omitempty"` // ndjson 模式下为 "result"
+	LocalFile   string       `json:"localFile"`
+	RemotePath  string       `json:"remotePath,omitempty"`
+	URL         string       `json:"url,omitempty"`
+	Link        string       `json:"link,omitempty"` // 按 --format 渲染的链接
+	Size        int64        `json:"size"`
+	ContentType string       `json:"contentType,omitempty"`
+	MD5         string       `json:"md5,omitempty"`
+	SHA1        string       `json:"sha1,omitempty"`
+	Success     bool         `json:"success"`
+	Skipped     bool         `json:"skipped"` // 远程已存在相同文件，未重复上传
+	Error       *errorRecord `json:"error,omitempty"`
+	DurationMs  int64        `json:"durationMs"`
+}
+
+// summaryRecord 是 JSON 输出中的汇总信息
+type summaryRecord struct {
+	Type       string `json:"type,omitempty"` // ndjson 模式下为 "summary"
+	Tag        string `json:"tag"`
+	Total      int    `json:"total"`
+	Succeeded  int    `json:"succeeded"` // 成功的文件数 (包括跳过的文件)
+	Skipped    int    `json:"skipped"`
+	Failed     int    `json:"failed"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// newResultRecord 将上传结果转换为 JSON 记录
+func newResultRecord(res b2.UploadResult) resultRecord {
+	record := resultRecord{
+		LocalFile:   res.LocalFile,
+		RemotePath:  res.RemotePath,
+		URL:         res.PublicURL,
+		Size:        res.Size,
+		ContentType: res.ContentType,
+		MD5:         res.MD5,
+		SHA1:        res.SHA1,
+		Success:     res.Error == nil,
+		Skipped:     res.Skipped,
+		DurationMs:  res.Duration.Milliseconds(),
+	}
+	if res.Error != nil {
+		record.Error = &errorRecord{Code: b2.ErrorCode(res.Error), Message: res.Error.Error()}
+	} else if linkRenderer != nil {
+		record.Link = renderLink(res)
+	}
+	return record
+}
+
+// reportResults 按 --output 指定的格式输出所有上传结果和汇总
+func reportResults(tagName string, results []b2.UploadResult, duration time.Duration) {
+	summary := summaryRecord{Tag: tagName, Total: len(results), DurationMs: duration.Milliseconds()}
+	for _, res := range results {
+		switch {
+		case res.Error != nil:
+			summary.Failed++
+		case res.Skipped:
+			summary.Skipped++
+			summary.Succeeded++
+		default:
+			summary.Succeeded++
+		}
+	}
+
+	switch outputFormat {
+	case outputJSON:
+		records := make([]resultRecord, 0, len(results))
+		for _, res := range results {
+			records = append(records, newResultRecord(res))
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(struct {
+			Results []resultRecord `json:"results"`
+			Summary summaryRecord  `json:"summary"`
+		}{records, summary})
+
+	case outputNDJSON:
+		enc := json.NewEncoder(os.Stdout)
+		for _, res := range results {
+			record := newResultRecord(res)
+			record.Type = "result"
+			enc.Encode(record)
+		}
+		summary.Type = "summary"
+		enc.Encode(summary)
+
+	default:
+		if linkRenderer != nil {
+			// 标准输出只输出链接，失败信息和汇总输出到标准错误
+			for _, res := range results {
+				if res.Error != nil {
+					fmt.Fprintf(os.Stderr, "上传失败，原文件是：%s，错误信息：%v\n", filepath.Base(res.LocalFile), res.Error)
+				} else {
+					fmt.Println(renderLink(res))
+				}
+			}
+			fmt.Fprintf(os.Stderr, "上传完成。成功 %d 个，失败 %d 个，本次用时 %.2f 秒\n", summary.Succeeded, summary.Failed, duration.Seconds())
+			return
+		}
+		for _, res := range results {
+			if res.Error != nil {
+				fmt.Printf("上传失败，原文件是：%s，错误信息：%v\n", filepath.Base(res.LocalFile), res.Error)
+			} else {
+				fmt.Printf("上传成功，原文件是：%s 远程路径文件：%s\n", filepath.Base(res.LocalFile), res.PublicURL)
+			}
+		}
+		if summary.Failed == 0 {
+			fmt.Printf("全部 %d 个文件上传成功，本次用时 %.2f 秒\n", summary.Succeeded, duration.Seconds())
+		} else {
+			fmt.Printf("上传完成。成功 %d 个，失败 %d 个，本次用时 %.2f 秒\n", summary.Succeeded, summary.Failed, duration.Seconds())
+		}
+	}
+}
+
+// reportTypora 按 Typora / PicGo 的约定输出结果：全部成功时标准输出第一行为 "Upload Success:"，
+// 之后按输入顺序每行一个 URL；有文件失败时标准输出为空，失败的文件列表输出到标准错误，返回 false
+func reportTypora(results []b2.UploadResult) bool {
+	var failed []b2.UploadResult
+	for _, res := range results {
+		if res.Error != nil {
+			failed = append(failed, res)
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(os.Stderr, "Upload Failed: %d 个文件上传失败\n", len(failed))
+		for _, res := range failed {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", res.LocalFile, res.Error)
+		}
+		return false
+	}
+
+	fmt.Println("Upload Success:")
+	for _, res := range results {
+		fmt.Println(res.PublicURL)
+	}
+	return true
+}
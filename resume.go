@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/xa1st/b2upload/internal/b2"
+	"github.com/xa1st/b2upload/internal/util"
+)
+
+// resumeCmd 继续上传因中断而未完成的大文件
+var resumeCmd = &cobra.Command{
+	Use:   "resume [标签名]",
+	Short: "继续上传未完成的大文件",
+	Long:  `resume 读取本地保存的大文件上传进度，跳过 B2 中已存在的分片继续上传。可指定标签名只处理该标签下的文件。`,
+	Args:  cobra.MaximumNArgs(1),
+	Run:   runResume,
+}
+
+// abortCmd 取消未完成的大文件，并删除 B2 中已上传的分片
+var abortCmd = &cobra.Command{
+	Use:   "abort [标签名]",
+	Short: "取消未完成的大文件上传",
+	Long:  `abort 取消本地记录中所有未完成的大文件 (调用 b2_cancel_large_file 删除已上传的分片)，并清除上传进度。可指定标签名只处理该标签下的文件。`,
+	Args:  cobra.MaximumNArgs(1),
+	Run:   runAbort,
+}
+
+func init() {
+	rootCmd.AddCommand(resumeCmd, abortCmd)
+}
+
+// pendingLargeFiles 读取状态文件中未完成的大文件，并按标签分组
+func pendingLargeFiles(args []string) (*b2.StateStore, map[string][]*b2.LargeFileState, []string) {
+	store, err := openStateStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	groups := make(map[string][]*b2.LargeFileState)
+	var tags []string // 保持首次出现的顺序
+	for _, entry := range store.List() {
+		if len(args) == 1 && entry.Tag != args[0] {
+			continue
+		}
+		if _, ok := groups[entry.Tag]; !ok {
+			tags = append(tags, entry.Tag)
+		}
+		groups[entry.Tag] = append(groups[entry.Tag], entry)
+	}
+	return store, groups, tags
+}
+
+// authorizedUploader 为指定标签创建上传器并完成 B2 授权
+func authorizedUploader(tagName string, store *b2.StateStore) (*b2.Uploader, error) {
+	cfg, err := loadTagConfig(tagName)
+	if err != nil {
+		return nil, err
+	}
+	uploader := b2.NewUploader(cfg)
+	uploader.State = store
+	if err := uploader.AuthorizeAccount(); err != nil {
+		return nil, fmt.Errorf("B2 账户授权失败: %w", err)
+	}
+	return uploader, nil
+}
+
+// runResume 继续上传所有未完成的大文件
+func runResume(cmd *cobra.Command, args []string) {
+	store, groups, tags := pendingLargeFiles(args)
+	if len(tags) == 0 {
+		fmt.Println("没有未完成的大文件上传。")
+		return
+	}
+
+	failed := 0
+	for _, tagName := range tags {
+		uploader, err := authorizedUploader(tagName, store)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "标签 [%s]: %v\n", tagName, err)
+			failed += len(groups[tagName])
+			continue
+		}
+		for _, entry := range groups[tagName] {
+			fmt.Printf("继续上传 %s -> %s\n", entry.LocalFile, entry.RemotePath)
+			publicURL, err := uploader.ResumeLargeFile(entry)
+			if err != nil {
+				fmt.Printf("上传失败，原文件是：%s，错误信息：%v\n", entry.LocalFile, err)
+				failed++
+				continue
+			}
+			fmt.Printf("上传成功，原文件是：%s 远程路径文件：%s\n", entry.LocalFile, publicURL)
+			recordHistory(tagName, []b2.UploadResult{{
+				LocalFile:   entry.LocalFile,
+				RemotePath:  entry.RemotePath,
+				PublicURL:   publicURL,
+				Size:        entry.Size,
+				ContentType: util.ContentType(entry.LocalFile),
+				MD5:         entry.ContentMD5,
+				SHA1:        entry.ContentSha1,
+			}})
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runAbort 取消所有未完成的大文件
+func runAbort(cmd *cobra.Command, args []string) {
+	store, groups, tags := pendingLargeFiles(args)
+	if len(tags) == 0 {
+		fmt.Println("没有未完成的大文件上传。")
+		return
+	}
+
+	failed := 0
+	for _, tagName := range tags {
+		uploader, err := authorizedUploader(tagName, store)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "标签 [%s]: %v\n", tagName, err)
+			failed += len(groups[tagName])
+			continue
+		}
+		for _, entry := range groups[tagName] {
+			if err := uploader.AbortLargeFile(entry); err != nil {
+				fmt.Printf("取消失败，原文件是：%s，错误信息：%v\n", entry.LocalFile, err)
+				failed++
+				continue
+			}
+			fmt.Printf("已取消未完成的大文件：%s (%s)\n", entry.RemotePath, entry.LocalFile)
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
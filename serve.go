@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/xa1st/b2upload/internal/b2"
+	"github.com/xa1st/b2upload/internal/server"
+)
+
+// serveCmd 启动本地 HTTP 上传服务
+var serveCmd = &cobra.Command{
+	Use:   "serve [默认标签名]",
+	Short: "启动本地 HTTP 上传服务 (兼容 PicGo-Server 和 ShareX)",
+	Long: `serve 在本地启动 HTTP 上传服务，编辑器和截图工具可以直接 POST 到 /upload 上传文件：
+  - PicGo-Server 格式的 JSON 请求体 {"list": ["本地文件路径"]}
+  - multipart 表单上传 (ShareX 自定义上传器)
+  - 原始请求体 (文件名可通过 name 参数或 Content-Disposition 指定)
+标签通过 tag 查询参数指定，未指定时使用命令行给出的默认标签。响应为 JSON，result 字段为公开 URL 列表。
+按本地路径上传 (JSON 请求) 以及监听在非回环地址时，必须设置 --auth-token；服务只接受 Host 为本机或监听地址的请求，
+并拒绝来自其他网站的跨域请求。请求体大小默认不超过 100 MB (可通过 serve.max_body_mb 配置)。`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runServe,
+}
+
+// serveListen 和 serveToken 是 --listen 和 --auth-token 的值
+var serveListen, serveToken string
+
+func init() {
+	serveCmd.Flags().StringVar(&serveListen, "listen", "", "监听地址 (默认 "+server.DefaultListen+"，也可通过 serve.listen 配置)")
+	serveCmd.Flags().StringVar(&serveToken, "auth-token", "", "要求请求携带 Authorization: Bearer <token> (也可通过 serve.token 配置)")
+	rootCmd.AddCommand(serveCmd)
+}
+
+// runServe 启动上传服务，收到中断信号后优雅退出
+func runServe(cmd *cobra.Command, args []string) {
+	listen := firstNonEmpty(serveListen, viper.GetString("serve.listen"), server.DefaultListen)
+	token := firstNonEmpty(serveToken, viper.GetString("serve.token"))
+	defaultTag := viper.GetString("serve.tag")
+	if len(args) == 1 {
+		defaultTag = args[0]
+	}
+
+	store, err := openStateStore()
+	if err != nil {
+		fmt.Printf("警告: %v，本次上传不支持断点续传\n", err)
+	}
+	srv := server.New(defaultTag, token, func(tag string) (*b2.Uploader, error) {
+		fmt.Printf("正在使用配置标签: [%s]\n", tag)
+		return authorizedUploader(tag, store)
+	})
+
+	srv.Listen = listen
+	if maxBody := viper.GetInt64("serve.max_body_mb"); maxBody > 0 {
+		srv.MaxBodySize = maxBody * 1024 * 1024
+	}
+	srv.OnUpload = recordHistory
+	if srv.RequiresToken() && token == "" {
+		fmt.Fprintf(os.Stderr, "错误: 服务监听在 %s，局域网中的其他设备也可以访问，必须通过 --auth-token 或 serve.token 设置 Token\n", listen)
+		os.Exit(1)
+	}
+
+	// 提前授权默认标签，配置有误时立即报错
+	if defaultTag != "" {
+		if _, err := srv.Uploader(defaultTag); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	httpServer := &http.Server{Addr: listen, Handler: srv.Handler(), ReadHeaderTimeout: 30 * time.Second}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("上传服务已启动: http://%s/upload\n", listen)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "错误: 启动上传服务失败: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("上传服务已停止")
+}
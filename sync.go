@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xa1st/b2upload/internal/b2"
+	"github.com/xa1st/b2upload/internal/util"
+)
+
+// syncCmd 将本地文件夹同步到 B2
+var syncCmd = &cobra.Command{
+	Use:   "sync <标签名> <本地文件夹> [远程前缀]",
+	Short: "将本地文件夹同步到 B2，只上传新增或修改的文件",
+	Long: `sync 将本地文件夹 (包括子目录) 同步到 用户名/[远程前缀/] 下，远程路径与本地相对路径一致，不使用 path_template。
+先列出远程文件，按大小和 SHA1 (--compare mtime 时优先比较上传时保存的修改时间) 对比，只上传新增或修改的文件。
+使用 --delete 删除 (或 --hide 隐藏) 本地已不存在的远程文件；使用 --dry-run 只显示将要执行的操作。`,
+	Args: cobra.RangeArgs(2, 3),
+	Run:  runSync,
+}
+
+// 对比方式
+const (
+	compareSHA1  = "sha1"
+	compareMtime = "mtime"
+	compareSize  = "size"
+)
+
+var (
+	syncOpts    util.FindOptions
+	syncCompare string // 大小相同时判断文件是否修改的方式
+	syncDelete  bool   // 删除本地不存在的远程文件 (所有版本)
+	syncHide    bool   // 隐藏本地不存在的远程文件
+	syncDryRun  bool   // 只显示计划，不执行
+)
+
+func init() {
+	syncCmd.Flags().StringArrayVar(&syncOpts.Include, "include", nil, "只同步匹配的文件，可多次指定")
+	syncCmd.Flags().StringArrayVar(&syncOpts.Exclude, "exclude", nil, "排除匹配的文件或目录，可多次指定")
+	syncCmd.Flags().BoolVar(&syncOpts.Hidden, "hidden", false, "包含隐藏文件和目录")
+	syncCmd.Flags().BoolVar(&syncOpts.FollowSymlinks, "follow-symlinks", false, "跟随符号链接")
+	syncCmd.Flags().StringVar(&syncCompare, "compare", compareSHA1, "大小相同时的对比方式：sha1、mtime (修改时间相同视为未修改) 或 size (只比较大小)")
+	syncCmd.Flags().BoolVar(&syncDelete, "delete", false, "删除本地已不存在的远程文件 (包括所有旧版本)")
+	syncCmd.Flags().BoolVar(&syncHide, "hide", false, "隐藏本地已不存在的远程文件 (保留旧版本，可恢复)")
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "只显示将要上传、删除或隐藏的文件，不做任何修改")
+	syncCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "上传结果的输出格式：text、json 或 ndjson")
+	rootCmd.AddCommand(syncCmd)
+}
+
+// syncPlan 是对比本地和远程文件后得到的同步计划
+type syncPlan struct {
+	added   []util.SourceFile // 远程不存在的文件
+	changed []util.SourceFile // 远程存在但内容不同的文件
+	removed []string          // 本地已不存在的远程文件名
+	same    int               // 内容一致、无需上传的文件数
+}
+
+// runSync 对比本地和远程文件，上传新增和修改的文件，按需删除或隐藏多余的远程文件
+func runSync(cmd *cobra.Command, args []string) {
+	if err := validateOutputFormat(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if syncDelete && syncHide {
+		fmt.Fprintln(os.Stderr, "错误: --delete 和 --hide 不能同时使用")
+		os.Exit(1)
+	}
+	if syncCompare != compareSHA1 && syncCompare != compareMtime && syncCompare != compareSize {
+		fmt.Fprintf(os.Stderr, "错误: 不支持的对比方式 %q，可选值为 sha1、mtime、size\n", syncCompare)
+		os.Exit(1)
+	}
+	if info, err := os.Stat(args[1]); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "错误: %s 不是文件夹\n", args[1])
+		os.Exit(1)
+	}
+	startTime := time.Now()
+
+	tagName := args[0]
+	uploader, err := authorizedUploader(tagName, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	uploader.Log = logOut()
+
+	// 1. 远程路径为 用户名/[远程前缀/]相对路径，远程前缀可以省略用户名
+	remoteDir := ""
+	if len(args) == 3 {
+		remoteDir = strings.TrimPrefix(strings.Trim(args[2], "/")+"/", uploader.Config.User+"/")
+		if remoteDir == "/" {
+			remoteDir = ""
+		}
+	}
+	if strings.ContainsAny(remoteDir, "{}") {
+		fmt.Fprintln(os.Stderr, "错误: 远程前缀不能包含 { 或 }")
+		os.Exit(1)
+	}
+	if remoteDir == "" && (syncDelete || syncHide) {
+		// 用户名目录下还有其他方式上传的文件，不指定前缀时会被全部删除
+		fmt.Fprintln(os.Stderr, "错误: 使用 --delete 或 --hide 时必须指定远程前缀，避免删除用户名目录下的其他文件")
+		os.Exit(1)
+	}
+	prefix := uploader.Config.User + "/" + remoteDir
+	if err := uploader.Config.SetPathTemplate("{user}/" + remoteDir + "{relpath}"); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	// 2. 列出本地和远程文件并对比
+	opts := syncOpts
+	opts.Recursive = true
+	local, err := util.FindFiles(args[1], opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "警告: 查找文件失败: %v\n", err)
+		if syncDelete || syncHide {
+			// 本地列表不完整时删除远程文件可能误删
+			fmt.Fprintln(os.Stderr, "错误: 本地文件列表不完整，已取消同步")
+			os.Exit(1)
+		}
+	}
+	remote, err := listRemoteFiles(uploader, prefix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 列出远程文件失败: %v\n", err)
+		os.Exit(1)
+	}
+	plan := planSync(args[1], local, remote, prefix, opts)
+
+	// 3. 显示计划
+	out := logOut()
+	for _, f := range plan.added {
+		fmt.Fprintf(out, "新增  %s\n", f.Rel)
+	}
+	for _, f := range plan.changed {
+		fmt.Fprintf(out, "修改  %s\n", f.Rel)
+	}
+	removeAction := ""
+	switch {
+	case syncDelete:
+		removeAction = "删除"
+	case syncHide:
+		removeAction = "隐藏"
+	}
+	if removeAction != "" {
+		for _, name := range plan.removed {
+			fmt.Fprintf(out, "%s  %s\n", removeAction, strings.TrimPrefix(name, prefix))
+		}
+	}
+	fmt.Fprintf(out, "同步到 %s：新增 %d 个，修改 %d 个，未变化 %d 个，远程多余 %d 个\n",
+		prefix, len(plan.added), len(plan.changed), plan.same, len(plan.removed))
+	if removeAction == "" && len(plan.removed) > 0 {
+		fmt.Fprintln(out, "提示: 使用 --delete 或 --hide 处理本地已不存在的远程文件")
+	}
+	if syncDryRun {
+		fmt.Fprintln(out, "--dry-run: 未做任何修改。")
+		return
+	}
+
+	// 4. 上传新增和修改的文件，修改的文件会在远程生成新版本
+	failed := 0
+	toUpload := append(plan.added, plan.changed...)
+	if len(toUpload) > 0 {
+		if uploader.State, err = openStateStore(); err != nil {
+			fmt.Fprintf(out, "警告: %v，本次上传不支持断点续传\n", err)
+		}
+		uploader.Overwrite = true
+		results := uploader.UploadFiles(toUpload)
+		recordHistory(tagName, results)
+		reportResults(tagName, results, time.Since(startTime))
+		for _, res := range results {
+			if res.Error != nil {
+				failed++
+			}
+		}
+	} else if outputFormat != outputText {
+		reportResults(tagName, nil, time.Since(startTime))
+	}
+
+	// 5. 删除或隐藏本地已不存在的远程文件
+	if removeAction != "" {
+		for _, name := range plan.removed {
+			if err := removeRemote(uploader, name); err != nil {
+				fmt.Fprintf(os.Stderr, "%s失败：%s，错误信息：%v\n", removeAction, name, err)
+				failed++
+				continue
+			}
+			fmt.Fprintf(out, "已%s：%s\n", removeAction, name)
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// listRemoteFiles 分页列出前缀下所有可见的文件，返回 文件名 -> 文件信息
+func listRemoteFiles(uploader *b2.Uploader, prefix string) (map[string]b2.UploadFileResponse, error) {
+	files := make(map[string]b2.UploadFileResponse)
+	startFileName := ""
+	for {
+		page, err := uploader.ListFileNames(prefix, "", startFileName, b2.MaxListPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range page.Files {
+			if f.Action == "upload" {
+				files[f.FileName] = f
+			}
+		}
+		if page.NextFileName == "" {
+			return files, nil
+		}
+		startFileName = page.NextFileName
+	}
+}
+
+// planSync 对比本地文件夹 root 中找到的文件和远程文件。远程多余的文件只包含通过 include/exclude 过滤、
+// 且在本地已不存在的文件，避免删除本次同步范围之外的文件
+func planSync(root string, local []util.SourceFile, remote map[string]b2.UploadFileResponse, prefix string, opts util.FindOptions) syncPlan {
+	var plan syncPlan
+	seen := make(map[string]bool, len(local))
+	for _, f := range local {
+		name := prefix + f.Rel
+		seen[name] = true
+		r, ok := remote[name]
+		if !ok {
+			plan.added = append(plan.added, f)
+			continue
+		}
+		same, err := sameContent(f.Path, &r)
+		if err != nil {
+			fmt.Fprintf(logOut(), "警告: %v，将重新上传\n", err)
+		}
+		if same {
+			plan.same++
+		} else {
+			plan.changed = append(plan.changed, f)
+		}
+	}
+	for name := range remote {
+		rel := strings.TrimPrefix(name, prefix)
+		if seen[name] || !opts.Matches(rel) {
+			continue
+		}
+		// 本地仍存在、但被 .b2ignore、符号链接或非普通文件规则跳过的路径不算已删除
+		if _, err := os.Lstat(filepath.Join(root, filepath.FromSlash(rel))); err == nil {
+			continue
+		}
+		plan.removed = append(plan.removed, name)
+	}
+	sort.Strings(plan.removed)
+	return plan
+}
+
+// sameContent 判断本地文件与远程文件是否一致：大小不同一定不一致；
+// 大小相同时按 --compare 比较修改时间或 SHA1，远程没有保存 SHA1 时视为不一致
+func sameContent(localPath string, r *b2.UploadFileResponse) (bool, error) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return false, fmt.Errorf("无法读取文件 %s: %w", localPath, err)
+	}
+	if info.Size() != r.ContentLength {
+		return false, nil
+	}
+	switch syncCompare {
+	case compareSize:
+		return true, nil
+	case compareMtime:
+		if millis, err := strconv.ParseInt(r.FileInfo[b2.FileInfoLastModified], 10, 64); err == nil && millis == info.ModTime().UnixMilli() {
+			return true, nil
+		}
+	}
+	remoteSha1 := r.SHA1()
+	if remoteSha1 == "" {
+		return false, nil
+	}
+	hashes, err := util.HashFile(localPath, false)
+	if err != nil {
+		return false, fmt.Errorf("无法计算 %s 的 SHA1: %w", filepath.Base(localPath), err)
+	}
+	return hashes.SHA1 == remoteSha1, nil
+}
+
+// removeRemote 按 --delete 删除文件的所有版本，或按 --hide 隐藏文件
+func removeRemote(uploader *b2.Uploader, name string) error {
+	if syncHide {
+		return uploader.HideFile(name)
+	}
+	versions, err := uploader.FileVersions(name)
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		if err := uploader.DeleteFileVersion(v.FileName, v.FileID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
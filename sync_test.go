@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/xa1st/b2upload/internal/b2"
+	"github.com/xa1st/b2upload/internal/util"
+)
+
+// TestPlanSyncKeepsSkippedLocalFiles 检查被 .b2ignore、符号链接或 include/exclude 跳过、但本地仍存在的文件不会被当作已删除
+func TestPlanSyncKeepsSkippedLocalFiles(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		util.IgnoreFileName: "*.log\nbuild/\n",
+		"a.png":             "aaa",
+		"same.png":          "same",
+		"debug.log":         "log",
+		"build/out.png":     "out",
+		"sub/b.png":         "bbb",
+	}
+	for name, content := range files {
+		full := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "a.png"), filepath.Join(root, "link.png")); err != nil {
+		t.Skipf("无法创建符号链接: %v", err)
+	}
+
+	opts := util.FindOptions{Recursive: true, Exclude: []string{"*.tmp"}}
+	local, err := util.FindFiles(root, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const prefix = "alice/site/"
+	remote := map[string]b2.UploadFileResponse{}
+	for _, name := range []string{"a.png", "debug.log", "build/out.png", "link.png", "gone.png", "sub/gone.png", "old.tmp"} {
+		remote[prefix+name] = b2.UploadFileResponse{FileName: prefix + name, ContentLength: 100}
+	}
+	remote[prefix+"same.png"] = b2.UploadFileResponse{FileName: prefix + "same.png", ContentLength: 4}
+
+	syncCompare = compareSize
+	t.Cleanup(func() { syncCompare = compareSHA1 })
+	plan := planSync(root, local, remote, prefix, opts)
+
+	var added, changed []string
+	for _, f := range plan.added {
+		added = append(added, f.Rel)
+	}
+	for _, f := range plan.changed {
+		changed = append(changed, f.Rel)
+	}
+	if want := []string{"sub/b.png"}; !slices.Equal(added, want) {
+		t.Errorf("added = %q，期望 %q", added, want)
+	}
+	if want := []string{"a.png"}; !slices.Equal(changed, want) {
+		t.Errorf("changed = %q，期望 %q", changed, want)
+	}
+	if plan.same != 1 {
+		t.Errorf("same = %d，期望 1", plan.same)
+	}
+	// debug.log、build/out.png 和 link.png 在本地仍存在，old.tmp 不在同步范围内
+	if want := []string{prefix + "gone.png", prefix + "sub/gone.png"}; !slices.Equal(plan.removed, want) {
+		t.Errorf("removed = %q，期望 %q", plan.removed, want)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/xa1st/b2upload/internal/b2"
+	"github.com/xa1st/b2upload/internal/util"
+	"github.com/xa1st/b2upload/internal/watch"
+)
+
+// watchCmd 监视文件夹，自动上传新出现的文件
+var watchCmd = &cobra.Command{
+	Use:   "watch <标签名> <文件夹>",
+	Short: "监视文件夹并自动上传新文件",
+	Long: `watch 监视指定文件夹 (例如截图目录)，文件写入完成后自动上传。
+已上传的文件记录在本地 (默认为配置文件同目录下的 b2upload.watch.json)，重启后不会重复上传。
+可通过 --exec 或 watch.hook 配置在每个文件上传成功后执行命令，命令可通过环境变量获取结果：
+  B2UPLOAD_URL          公开 URL
+  B2UPLOAD_LINK         按 --format / 标签 format 渲染的链接 (未设置链接格式时等于 URL)
+  B2UPLOAD_FILE         本地文件路径
+  B2UPLOAD_REMOTE_PATH  B2 中的文件名`,
+	Args: cobra.ExactArgs(2),
+	Run:  runWatch,
+}
+
+var (
+	watchOpts     util.FindOptions // 过滤新文件的选项
+	watchQuiet    time.Duration    // 防抖时间
+	watchHook     string           // 上传成功后执行的命令
+	watchExisting bool             // 启动时上传文件夹中尚未上传过的已有文件
+)
+
+func init() {
+	watchCmd.Flags().BoolVarP(&watchOpts.Recursive, "recursive", "r", false, "同时监视子文件夹")
+	watchCmd.Flags().StringArrayVar(&watchOpts.Include, "include", nil, "只上传匹配该模式的文件，可多次指定")
+	watchCmd.Flags().StringArrayVar(&watchOpts.Exclude, "exclude", nil, "忽略匹配该模式的文件，可多次指定")
+	watchCmd.Flags().BoolVar(&watchOpts.Hidden, "hidden", false, "包含隐藏文件 (名称以 . 开头)")
+	watchCmd.Flags().DurationVar(&watchQuiet, "debounce", watch.DefaultQuiet, "文件在这段时间内没有新的写入才开始上传")
+	watchCmd.Flags().StringVar(&watchHook, "exec", "", "每个文件上传成功后执行的命令 (也可通过 watch.hook 配置)")
+	watchCmd.Flags().BoolVar(&watchExisting, "existing", false, "启动时先上传文件夹中尚未上传过的已有文件")
+	watchCmd.Flags().StringVarP(&linkFormat, "format", "f", "", "链接格式，用于 B2UPLOAD_LINK (markdown、html、bbcode、rst、url 或 template)")
+	watchCmd.Flags().StringVar(&linkTemplate, "template", "", "自定义链接模板 (Go text/template)")
+	rootCmd.AddCommand(watchCmd)
+}
+
+// openWatchRecord 打开 watch 的已处理文件记录 (可通过 watch.state_file 配置项指定路径)
+func openWatchRecord() (*watch.Record, error) {
+	path := viper.GetString("watch.state_file")
+	if path == "" {
+		path = filepath.Join(appDir(), "b2upload.watch.json")
+	}
+	return watch.OpenRecord(path)
+}
+
+// runWatch 监视文件夹直到收到中断信号
+func runWatch(cmd *cobra.Command, args []string) {
+	tagName, dir := args[0], args[1]
+
+	store, err := openStateStore()
+	if err != nil {
+		fmt.Printf("警告: %v，本次上传不支持断点续传\n", err)
+	}
+	// 上传器在整个监视期间保持授权，Token 过期时会自动重新授权
+	uploader, err := authorizedUploader(tagName, store)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if linkRenderer, err = loadLinkRenderer(tagName); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	record, err := openWatchRecord()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+	hook := firstNonEmpty(watchHook, viper.GetString("tags."+tagName+".watch_hook"), viper.GetString("watch.hook"))
+
+	watcher, err := watch.New(dir, watchOpts.Recursive, watchQuiet)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 配置文件、状态文件、上传历史和已处理文件记录可能位于监视的文件夹中：
+	// 上传它们会泄露密钥，写入记录又会触发新的事件导致循环上传
+	isOwnFile := ownFileFilter(viper.ConfigFileUsed(), stateFilePath(), historyFilePath(), record.Path())
+	watcher.Ignore = isOwnFile
+	process := func(path string) {
+		if isOwnFile(path) {
+			return
+		}
+		watchUpload(uploader, record, tagName, dir, path, hook)
+	}
+
+	if watchExisting {
+		files, err := util.FindFiles(dir, watchOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "警告: 查找已有文件失败: %v\n", err)
+		}
+		for _, file := range files {
+			process(file.Path)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Printf("正在监视 %s (标签: %s)，按 Ctrl+C 退出\n", dir, tagName)
+	watcher.Run(ctx, process)
+	fmt.Println("已停止监视")
+}
+
+// ownFileFilter 返回判断文件是否为 paths 之一 (或 util.WriteFileAtomic 写入它们时的临时文件) 的函数
+func ownFileFilter(paths ...string) func(path string) bool {
+	var own []string
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(p); err == nil {
+			own = append(own, abs)
+		}
+	}
+	return func(path string) bool {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return false
+		}
+		dir, name := filepath.Split(abs)
+		for _, p := range own {
+			if abs == p {
+				return true
+			}
+			// 临时文件名为 <文件名>.<随机数>.tmp
+			ownDir, ownName := filepath.Split(p)
+			if dir == ownDir && strings.HasPrefix(name, ownName+".") && strings.HasSuffix(name, ".tmp") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// watchUpload 上传一个写入完成的文件，已上传过 (大小和修改时间未变) 或被过滤的文件会被跳过
+func watchUpload(uploader *b2.Uploader, record *watch.Record, tagName, root, path, hook string) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+	rel = filepath.ToSlash(rel)
+	if !watchOpts.Matches(rel) {
+		return
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	stat, err := os.Stat(abs)
+	if err != nil || !stat.Mode().IsRegular() || record.Processed(abs, stat) {
+		return
+	}
+
+	results := uploader.UploadFiles([]util.SourceFile{{Path: path, Rel: rel}})
+	recordHistory(tagName, results)
+	res := results[0]
+	if res.Error != nil {
+		fmt.Printf("上传失败，原文件是：%s，错误信息：%v\n", rel, res.Error)
+		return
+	}
+	fmt.Printf("上传成功，原文件是：%s 远程路径文件：%s\n", rel, res.PublicURL)
+
+	err = record.Add(abs, &watch.ProcessedFile{
+		Tag:        tagName,
+		Size:       stat.Size(),
+		ModTime:    stat.ModTime(),
+		URL:        res.PublicURL,
+		UploadedAt: time.Now(),
+	})
+	if err != nil {
+		fmt.Printf("警告: %v\n", err)
+	}
+
+	if hook != "" {
+		link := res.PublicURL
+		if linkRenderer != nil {
+			link = renderLink(res)
+		}
+		runHook(hook, res, link)
+	}
+}
+
+// runHook 通过系统 shell 执行上传成功后的命令，上传结果通过环境变量传入
+func runHook(hook string, res b2.UploadResult, link string) {
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.Command("cmd", "/C", hook)
+	} else {
+		c = exec.Command("sh", "-c", hook)
+	}
+	c.Env = append(os.Environ(),
+		"B2UPLOAD_URL="+res.PublicURL,
+		"B2UPLOAD_LINK="+link,
+		"B2UPLOAD_FILE="+res.LocalFile,
+		"B2UPLOAD_REMOTE_PATH="+res.RemotePath,
+	)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		fmt.Printf("警告: 执行命令 %q 失败: %v\n", hook, err)
+	}
+}